@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// noneBucket counts records that lack the key being tallied.
+const noneBucket = "<none>"
+
+// tally counts the distinct values of a key across all records.
+type tally struct {
+	key    string
+	counts map[string]int
+}
+
+func newTally(key string) *tally {
+	return &tally{key: key, counts: map[string]int{}}
+}
+
+func (t *tally) add(rec map[string]interface{}) error {
+	bucket := noneBucket
+	if v, exists := rec[t.key]; exists {
+		bucket = fmt.Sprint(v)
+	}
+	t.counts[bucket]++
+	return nil
+}
+
+// write prints a value<TAB>count line for each distinct value, most frequent
+// first and ties in value order.
+func (t *tally) write(w io.Writer) error {
+	values := make([]string, 0, len(t.counts))
+	for v := range t.counts {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if ci, cj := t.counts[values[i]], t.counts[values[j]]; ci != cj {
+			return ci > cj
+		}
+		return values[i] < values[j]
+	})
+
+	for _, v := range values {
+		if _, err := fmt.Fprintf(w, "%s\t%d\n", v, t.counts[v]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
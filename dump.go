@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/ayang64/ginsu/lex"
+)
+
+// dumpTokens writes each token lexed from r to w, for -dump-tokens.  tokens
+// are written one per line as their type and value, or as json when asJSON is
+// set.
+func dumpTokens(w io.Writer, r io.Reader, asJSON bool, opts ...func(*lex.Lexer) error) error {
+	lexer, err := lex.NewLexer(append([]func(*lex.Lexer) error{lex.WithReader(r)}, opts...)...)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	for tok := range lexer.Lex() {
+		switch {
+		case asJSON:
+			err = enc.Encode(tok)
+		case tok.Value == nil:
+			_, err = fmt.Fprintf(w, "%v\n", tok.Type)
+		default:
+			// quote strings so white space and control characters show.
+			format := "%v\t%v\n"
+			if _, isString := tok.Value.(string); isString {
+				format = "%v\t%q\n"
+			}
+			_, err = fmt.Fprintf(w, format, tok.Type, tok.Value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package encode
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// CSV encodes records as rows of a csv (or tsv) table.  the columns are either
+// given up front or discovered from the keys of the first record, and a header
+// row naming them is written before the first row.  rows are buffered until
+// Flush, or until a record is encoded into a different writer.
+type CSV struct {
+	comma   rune
+	w       io.Writer
+	cw      *csv.Writer
+	columns []string
+	started bool
+}
+
+// NewCSV returns an encoder of rows separated by comma, such as ',' or '\t',
+// with the given columns.  with no columns they are the sorted keys of the
+// first record.
+func NewCSV(comma rune, columns []string) *CSV {
+	return &CSV{comma: comma, columns: columns}
+}
+
+func (c *CSV) Encode(w io.Writer, rec map[string]interface{}) error {
+	if c.cw == nil || w != c.w {
+		if err := c.Flush(); err != nil {
+			return err
+		}
+		c.w, c.cw = w, csv.NewWriter(w)
+		c.cw.Comma = c.comma
+	}
+
+	if !c.started {
+		if len(c.columns) == 0 {
+			for k := range rec {
+				c.columns = append(c.columns, k)
+			}
+			sort.Strings(c.columns)
+		}
+		if err := c.cw.Write(c.columns); err != nil {
+			return err
+		}
+		c.started = true
+	}
+
+	row := make([]string, len(c.columns))
+	for i, col := range c.columns {
+		if v, exists := rec[col]; exists {
+			row[i] = fmt.Sprint(v)
+		}
+	}
+	return c.cw.Write(row)
+}
+
+func (c *CSV) Flush() error {
+	if c.cw == nil {
+		return nil
+	}
+	c.cw.Flush()
+	return c.cw.Error()
+}
@@ -0,0 +1,56 @@
+package encode
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCSV(t *testing.T) {
+	records := []map[string]interface{}{
+		{"a": "1", "b": "x, y"},
+		{"b": `say "hi"`, "c": "3"},
+	}
+
+	tests := map[string]struct {
+		comma    rune
+		columns  []string
+		expected string
+	}{
+		"Discovered Columns": {
+			comma:    ',',
+			expected: "a,b\n1,\"x, y\"\n,\"say \"\"hi\"\"\"\n",
+		},
+		"Given Columns": {
+			comma:    ',',
+			columns:  []string{"c", "a"},
+			expected: "c,a\n,1\n3,\n",
+		},
+		"Tabs": {
+			comma:    '\t',
+			columns:  []string{"a", "b"},
+			expected: "a\tb\n1\tx, y\n\t\"say \"\"hi\"\"\"\n",
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			sb := &strings.Builder{}
+			enc := NewCSV(test.comma, test.columns)
+			for _, rec := range records {
+				if err := enc.Encode(sb, rec); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := enc.Flush(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := sb.String(); got != test.expected {
+				t.Fatalf("table rendered as %q; expected %q", got, test.expected)
+			}
+		})
+	}
+}
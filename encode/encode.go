@@ -0,0 +1,15 @@
+// Package encode writes parsed records out in the formats ginsu offers.
+package encode
+
+import "io"
+
+// Encoder writes records to w in some output format.  Flush writes whatever
+// an encoder held back, such as buffered rows, and must be called once the
+// last record has been encoded.
+//
+// encoders that hold no state between records, such as JSON and Template, may
+// encode concurrently into different writers.
+type Encoder interface {
+	Encode(w io.Writer, rec map[string]interface{}) error
+	Flush() error
+}
@@ -0,0 +1,110 @@
+package encode
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// JSON encodes each record as a line of json.
+type JSON struct {
+	fields []string
+}
+
+// NewJSON returns an encoder of json lines.  with fields, each line holds
+// just those keys in that order, rather than every key in the sorted order
+// encoding/json gives a map.
+func NewJSON(fields []string) *JSON {
+	return &JSON{fields: fields}
+}
+
+func (j *JSON) Encode(w io.Writer, rec map[string]interface{}) error {
+	b, err := marshalRecord(rec, j.fields)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+func (j *JSON) Flush() error {
+	return nil
+}
+
+// JSONArray encodes records as the elements of a single json array, which is
+// written as records are encoded rather than held until the end.
+type JSONArray struct {
+	w       io.Writer
+	fields  []string
+	started bool
+}
+
+// NewJSONArray returns an encoder of a json array written to w, which records
+// must be encoded into too.  the array is closed by Flush, which writes [] if
+// no records were encoded.  fields are as for NewJSON.
+func NewJSONArray(w io.Writer, fields []string) *JSONArray {
+	return &JSONArray{w: w, fields: fields}
+}
+
+func (j *JSONArray) Encode(w io.Writer, rec map[string]interface{}) error {
+	b, err := marshalRecord(rec, j.fields)
+	if err != nil {
+		return err
+	}
+
+	// every element but the first follows a comma.
+	sep := ",\n"
+	if !j.started {
+		sep = "[\n"
+	}
+	if _, err := io.WriteString(w, sep); err != nil {
+		return err
+	}
+	j.started = true
+
+	_, err = w.Write(b)
+	return err
+}
+
+func (j *JSONArray) Flush() error {
+	end := "\n]\n"
+	if !j.started {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(j.w, end)
+	return err
+}
+
+// marshalRecord returns rec as a json object.  with fields it holds just
+// those keys, in that order; keys missing from rec are left out.
+func marshalRecord(rec map[string]interface{}, fields []string) ([]byte, error) {
+	if len(fields) == 0 {
+		return json.Marshal(rec)
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	for _, f := range fields {
+		v, exists := rec[f]
+		if !exists {
+			continue
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+
+		k, err := json.Marshal(f)
+		if err != nil {
+			return nil, err
+		}
+		val, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,86 @@
+package encode
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestJSON(t *testing.T) {
+	records := []map[string]interface{}{
+		{"b": "x", "a": int64(1), "c": 2.5},
+		{"c": []interface{}{"p", "q"}},
+	}
+
+	tests := map[string]struct {
+		fields   []string
+		expected string
+	}{
+		"Sorted Keys":   {expected: `{"a":1,"b":"x","c":2.5}` + "\n" + `{"c":["p","q"]}` + "\n"},
+		"Field Order":   {fields: []string{"c", "a"}, expected: `{"c":2.5,"a":1}` + "\n" + `{"c":["p","q"]}` + "\n"},
+		"Missing Field": {fields: []string{"z"}, expected: "{}\n{}\n"},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			sb := &strings.Builder{}
+			enc := NewJSON(test.fields)
+			for _, rec := range records {
+				if err := enc.Encode(sb, rec); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := enc.Flush(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := sb.String(); got != test.expected {
+				t.Fatalf("records encoded as %q; expected %q", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestJSONArray(t *testing.T) {
+	tests := map[string]struct {
+		records  []map[string]interface{}
+		fields   []string
+		expected string
+	}{
+		"Empty":   {expected: "[]\n"},
+		"One":     {records: []map[string]interface{}{{"a": int64(1)}}, expected: "[\n{\"a\":1}\n]\n"},
+		"Several": {records: []map[string]interface{}{{"a": int64(1)}, {"b": "x"}, {}}, expected: "[\n{\"a\":1},\n{\"b\":\"x\"},\n{}\n]\n"},
+		"Fields":  {records: []map[string]interface{}{{"a": int64(1), "b": "x"}}, fields: []string{"b", "a"}, expected: "[\n{\"b\":\"x\",\"a\":1}\n]\n"},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			sb := &strings.Builder{}
+			enc := NewJSONArray(sb, test.fields)
+			for _, rec := range test.records {
+				if err := enc.Encode(sb, rec); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := enc.Flush(); err != nil {
+				t.Fatal(err)
+			}
+
+			got := sb.String()
+			if got != test.expected {
+				t.Fatalf("records encoded as %q; expected %q", got, test.expected)
+			}
+
+			var decoded []map[string]interface{}
+			if err := json.Unmarshal([]byte(got), &decoded); err != nil || len(decoded) != len(test.records) {
+				t.Fatalf("%q decoded as %v, %v; expected an array of %d records", got, decoded, err, len(test.records))
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package encode
+
+import (
+	"fmt"
+	"io"
+)
+
+// Switch encodes each record with the encoder chosen by the value of one of
+// its keys.
+type Switch struct {
+	key      string
+	cases    map[string]Encoder
+	fallback Encoder
+}
+
+// NewSwitch returns an encoder that encodes a record with cases[v], v being
+// the string form of the record's value of key.  records whose value has no
+// case, or that lack the key, are encoded with fallback.
+func NewSwitch(key string, cases map[string]Encoder, fallback Encoder) *Switch {
+	return &Switch{key: key, cases: cases, fallback: fallback}
+}
+
+func (s *Switch) Encode(w io.Writer, rec map[string]interface{}) error {
+	if v, exists := rec[s.key]; exists {
+		if enc, exists := s.cases[fmt.Sprint(v)]; exists {
+			return enc.Encode(w, rec)
+		}
+	}
+	return s.fallback.Encode(w, rec)
+}
+
+// Flush flushes every case and then the fallback, returning the first error.
+func (s *Switch) Flush() error {
+	var first error
+	for _, enc := range s.cases {
+		if err := enc.Flush(); err != nil && first == nil {
+			first = err
+		}
+	}
+	if err := s.fallback.Flush(); err != nil && first == nil {
+		first = err
+	}
+	return first
+}
@@ -0,0 +1,42 @@
+package encode
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestSwitch(t *testing.T) {
+	tests := map[string]struct {
+		rec      map[string]interface{}
+		expected string
+	}{
+		"Case":    {rec: map[string]interface{}{"level": "error", "msg": "hi"}, expected: "E hi\n"},
+		"Other":   {rec: map[string]interface{}{"level": "info", "msg": "hi"}, expected: "I hi\n"},
+		"NoCase":  {rec: map[string]interface{}{"level": "debug", "msg": "hi"}, expected: "? hi\n"},
+		"Missing": {rec: map[string]interface{}{"msg": "hi"}, expected: "? hi\n"},
+		"Number":  {rec: map[string]interface{}{"level": int64(3), "msg": "hi"}, expected: "3 hi\n"},
+	}
+
+	tmpl := func(s string) Encoder { return NewTemplate(template.Must(template.New("x").Parse(s))) }
+	enc := NewSwitch("level", map[string]Encoder{
+		"error": tmpl("E {{.msg}}\n"),
+		"info":  tmpl("I {{.msg}}\n"),
+		"3":     tmpl("3 {{.msg}}\n"),
+	}, tmpl("? {{.msg}}\n"))
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			sb := &strings.Builder{}
+			if err := enc.Encode(sb, test.rec); err != nil {
+				t.Fatalf(".Encode() returned error %v", err)
+			}
+			if got := sb.String(); got != test.expected {
+				t.Fatalf("record encoded as %q; expected %q", got, test.expected)
+			}
+		})
+	}
+}
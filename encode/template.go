@@ -0,0 +1,24 @@
+package encode
+
+import (
+	"io"
+	"text/template"
+)
+
+// Template encodes each record by executing a template with it.
+type Template struct {
+	tmpl *template.Template
+}
+
+// NewTemplate returns an encoder that executes tmpl with each record.
+func NewTemplate(tmpl *template.Template) *Template {
+	return &Template{tmpl: tmpl}
+}
+
+func (t *Template) Encode(w io.Writer, rec map[string]interface{}) error {
+	return t.tmpl.Execute(w, rec)
+}
+
+func (t *Template) Flush() error {
+	return nil
+}
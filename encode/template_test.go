@@ -0,0 +1,42 @@
+package encode
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestTemplate(t *testing.T) {
+	tests := map[string]struct {
+		tmpl      string
+		expected  string
+		shouldErr bool
+	}{
+		"Fields":  {tmpl: "{{.level}}: {{.msg}}\n", expected: "info: hi\n"},
+		"Missing": {tmpl: "{{.nope}}\n", expected: "<no value>\n"},
+		"Failure": {tmpl: "{{index .msg 10}}", shouldErr: true},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			tmpl := template.Must(template.New("x").Parse(test.tmpl))
+			enc := NewTemplate(tmpl)
+
+			sb := &strings.Builder{}
+			err := enc.Encode(sb, map[string]interface{}{"level": "info", "msg": "hi"})
+			if test.shouldErr != (err != nil) {
+				t.Fatalf(".Encode() returned error %v; expected an error: %v", err, test.shouldErr)
+			}
+			if test.shouldErr {
+				return
+			}
+
+			if got := sb.String(); got != test.expected {
+				t.Fatalf("record encoded as %q; expected %q", got, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// condition is a single -where expression such as status=500, level!=debug
+// or latency>0.5.
+type condition struct {
+	key   string
+	op    string
+	value string
+}
+
+// operators are the -where operators.  the two rune operators come first so
+// "a>=b" isn't read as the key "a" greater than "=b".
+var operators = []string{"!=", ">=", "<=", "=", ">", "<"}
+
+// parseCondition splits s at its first operator.  the key therefore can't
+// hold an operator character but the value can hold anything: url=/a?b=c is
+// the key url equal to "/a?b=c".
+func parseCondition(s string) (condition, error) {
+	for i := 1; i < len(s); i++ {
+		for _, op := range operators {
+			if strings.HasPrefix(s[i:], op) {
+				return condition{key: s[:i], op: op, value: s[i+len(op):]}, nil
+			}
+		}
+	}
+	return condition{}, fmt.Errorf("%q is not of the form key=value, key!=value, key>value, key>=value, key<value or key<=value", s)
+}
+
+// match reports whether rec satisfies the condition.  a record that lacks the
+// key never equals a value and so always satisfies !=, but fails every
+// ordering.
+//
+// = and != compare the value's string form.  the orderings compare numbers
+// when both the value and the operand are numeric and strings otherwise, so
+// status>=500 is numeric while level>info is lexical.
+func (c condition) match(rec map[string]interface{}) bool {
+	v, exists := rec[c.key]
+
+	switch c.op {
+	case "=":
+		return exists && fmt.Sprint(v) == c.value
+	case "!=":
+		return !exists || fmt.Sprint(v) != c.value
+	}
+
+	if !exists {
+		return false
+	}
+
+	cmp := strings.Compare(fmt.Sprint(v), c.value)
+	if a, ok := numeric(v); ok {
+		if b, err := strconv.ParseFloat(c.value, 64); err == nil {
+			cmp = compareFloats(a, b)
+		}
+	}
+
+	switch c.op {
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	}
+	return cmp <= 0
+}
+
+// numeric returns v as a float64 if it is a number or a string holding one.
+func numeric(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// conditions collects repeated -where flags.  a record must satisfy all of
+// them.
+type conditions []condition
+
+func (cs *conditions) String() string {
+	s := make([]string, 0, len(*cs))
+	for _, c := range *cs {
+		s = append(s, c.key+c.op+c.value)
+	}
+	return strings.Join(s, " ")
+}
+
+func (cs *conditions) Set(s string) error {
+	c, err := parseCondition(s)
+	if err != nil {
+		return err
+	}
+	*cs = append(*cs, c)
+	return nil
+}
+
+func (cs conditions) match(rec map[string]interface{}) bool {
+	for _, c := range cs {
+		if !c.match(rec) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,58 @@
+package main
+
+import "testing"
+
+func TestConditions(t *testing.T) {
+	rec := map[string]interface{}{"status": "500", "method": "GET", "latency": 0.75, "bytes": int64(900), "url": "/a?b=c"}
+
+	tests := map[string]struct {
+		where    []string
+		expected bool
+	}{
+		"Equal":               {where: []string{"status=500"}, expected: true},
+		"Equal Filtered":      {where: []string{"status=200"}, expected: false},
+		"Not Equal":           {where: []string{"method!=POST"}, expected: true},
+		"Not Equal Filtered":  {where: []string{"method!=GET"}, expected: false},
+		"Missing Key":         {where: []string{"user=bob"}, expected: false},
+		"Missing Not Equal":   {where: []string{"user!=bob"}, expected: true},
+		"All Must Match":      {where: []string{"status=500", "method=GET"}, expected: true},
+		"One Failure Filters": {where: []string{"status=500", "method=POST"}, expected: false},
+		"Greater":             {where: []string{"latency>0.5"}, expected: true},
+		"Greater Filtered":    {where: []string{"latency>1"}, expected: false},
+		"Numeric Not Lexical": {where: []string{"bytes>1000"}, expected: false},
+		"Greater Or Equal":    {where: []string{"status>=500"}, expected: true},
+		"Less":                {where: []string{"bytes<1000"}, expected: true},
+		"Less Or Equal":       {where: []string{"bytes<=899"}, expected: false},
+		"String Compare":      {where: []string{"method<POST"}, expected: true},
+		"String Filtered":     {where: []string{"method>POST"}, expected: false},
+		"Missing Ordering":    {where: []string{"user<zzz"}, expected: false},
+		"Operator In Value":   {where: []string{"url=/a?b=c"}, expected: true},
+		"Range":               {where: []string{"bytes>=800", "bytes<1000"}, expected: true},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var cs conditions
+			for _, w := range test.where {
+				if err := cs.Set(w); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if got := cs.match(rec); got != test.expected {
+				t.Fatalf("%v matching %v yielded %t; expected %t", test.where, rec, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestParseConditionRejectsMalformed(t *testing.T) {
+	for _, s := range []string{"status", "=500", ">1", ""} {
+		if _, err := parseCondition(s); err == nil {
+			t.Fatalf("parseCondition(%q) succeeded", s)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// follower is an io.Reader that behaves like tail -f.  instead of returning
+// io.EOF it waits for more data to be appended to the underlying reader.
+// reading only ends when done is closed.
+type follower struct {
+	r        io.Reader
+	interval time.Duration
+	done     <-chan struct{}
+	offset   int64
+}
+
+func newFollower(r io.Reader, interval time.Duration, done <-chan struct{}) *follower {
+	return &follower{r: r, interval: interval, done: done}
+}
+
+func (f *follower) Read(p []byte) (int, error) {
+	for {
+		n, err := f.r.Read(p)
+		f.offset += int64(n)
+
+		if err != io.EOF {
+			return n, err
+		}
+
+		if n > 0 {
+			return n, nil
+		}
+
+		f.rewindIfTruncated()
+
+		select {
+		case <-f.done:
+			return 0, io.EOF
+		case <-time.After(f.interval):
+		}
+	}
+}
+
+// rewindIfTruncated starts reading from the beginning of a file again if it
+// has shrunk below our read offset, as happens when a log is truncated in
+// place.  rotated files are not reopened; we keep polling the original one.
+func (f *follower) rewindIfTruncated() {
+	file, isFile := f.r.(*os.File)
+	if !isFile {
+		return
+	}
+
+	fi, err := file.Stat()
+	if err != nil || fi.Size() >= f.offset {
+		return
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err == nil {
+		f.offset = 0
+	}
+}
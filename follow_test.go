@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ayang64/ginsu/parse"
+)
+
+func TestFollower(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := ioutil.WriteFile(path, []byte("a=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	inf, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inf.Close()
+
+	done := make(chan struct{})
+	p, err := parse.NewParser(parse.WithReader(newFollower(inf, time.Millisecond, done)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := p.Parse()
+
+	next := func() map[string]interface{} {
+		select {
+		case m := <-records:
+			return m
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a record")
+		}
+		return nil
+	}
+
+	if got, expected := next(), map[string]interface{}{"a": int64(1)}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got %#v; expected %#v", got, expected)
+	}
+
+	// append after the follower has reached the end of the file.
+	outf, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer outf.Close()
+
+	for _, line := range []string{"b=2\n", "c=3\n"} {
+		time.Sleep(10 * time.Millisecond)
+		if _, err := outf.WriteString(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, expected := next(), map[string]interface{}{"b": int64(2)}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got %#v; expected %#v", got, expected)
+	}
+	if got, expected := next(), map[string]interface{}{"c": int64(3)}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got %#v; expected %#v", got, expected)
+	}
+
+	// truncating the file must not stop the follower.
+	if err := outf.Truncate(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := outf.WriteString("d=4\n"); err != nil {
+		t.Fatal(err)
+	}
+	if got, expected := next(), map[string]interface{}{"d": int64(4)}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got %#v; expected %#v", got, expected)
+	}
+
+	close(done)
+	for range records {
+	}
+}
+
+// lockedBuffer is a bytes.Buffer that can be written while it's being read.
+// like a file it returns io.EOF once it has been drained.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Read(p)
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// TestFollowerStream follows readers other than files.  the data after the
+// first line is only written once the follower has run out of input: a pipe
+// blocks in Read at that point while a buffer returns io.EOF.
+func TestFollowerStream(t *testing.T) {
+	tests := map[string]func() (io.Reader, io.WriteCloser){
+		"Pipe": func() (io.Reader, io.WriteCloser) {
+			pr, pw := io.Pipe()
+			return pr, pw
+		},
+		"Buffer": func() (io.Reader, io.WriteCloser) {
+			b := &lockedBuffer{}
+			return b, nopCloser{b}
+		},
+	}
+
+	for name, open := range tests {
+		open := open
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r, w := open()
+			go w.Write([]byte("a=1\n"))
+
+			done := make(chan struct{})
+			p, err := parse.NewParser(parse.WithReader(newFollower(r, time.Millisecond, done)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			records := p.Parse()
+
+			next := func() map[string]interface{} {
+				select {
+				case m := <-records:
+					return m
+				case <-time.After(5 * time.Second):
+					t.Fatal("timed out waiting for a record")
+				}
+				return nil
+			}
+
+			if got, expected := next(), map[string]interface{}{"a": int64(1)}; !reflect.DeepEqual(got, expected) {
+				t.Fatalf("got %#v; expected %#v", got, expected)
+			}
+
+			// give the follower time to run out of input before writing more.
+			time.Sleep(20 * time.Millisecond)
+			go w.Write([]byte("b=2\n"))
+
+			if got, expected := next(), map[string]interface{}{"b": int64(2)}; !reflect.DeepEqual(got, expected) {
+				t.Fatalf("got %#v; expected %#v", got, expected)
+			}
+
+			close(done)
+			w.Close()
+			for range records {
+			}
+		})
+	}
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
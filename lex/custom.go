@@ -0,0 +1,87 @@
+package lex
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// firstCustom is the first TokenType handed out by RegisterScanner.  the
+// types below it are kept for the lexer's own tokens.
+const firstCustom = TokenType(1 << 10)
+
+// scanner is a scanner added with RegisterScanner.
+type scanner struct {
+	predicate func(rune) bool
+	scan      func(*Lexer) (TokenType, string, error)
+}
+
+var registry struct {
+	sync.Mutex
+	scanners []scanner
+}
+
+// RegisterScanner adds a scanner for tokens of a type of its own, such as IP
+// addresses or UUIDs, and returns that type.  the scanner is offered the input
+// wherever a number, atom or unidentified run of input could start, as long as
+// the rune there satisfies predicate.  scan then reads the token, typically
+// with Peek and ScanWhile, and returns it.  if scan decides the input isn't
+// its kind after all, it returns an error matching ErrClassMismatch without
+// reading anything and the input is lexed as it would otherwise have been.
+// scanners are offered the input in the order they were registered.
+//
+// RegisterScanner is meant to be called from an init function: lexers only
+// know of the scanners registered before they were made with NewLexer.
+func RegisterScanner(predicate func(rune) bool, scan func(*Lexer) (TokenType, string, error)) TokenType {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.scanners = append(registry.scanners, scanner{predicate: predicate, scan: scan})
+	return firstCustom + TokenType(len(registry.scanners)-1)
+}
+
+// registered returns the scanners registered so far.
+func registered() []scanner {
+	registry.Lock()
+	defer registry.Unlock()
+	return registry.scanners[:len(registry.scanners):len(registry.scanners)]
+}
+
+// Custom reports whether t was handed out by RegisterScanner.
+func (t TokenType) Custom() bool {
+	return t >= firstCustom
+}
+
+// Peek returns up to the next n runes of the input without consuming them.  if
+// the input ends first, the runes that were available are returned along with
+// the error that ended them.
+func (l *Lexer) Peek(n int) ([]rune, error) {
+	return l.peekN(n)
+}
+
+// ScanWhile scans a token of type t out of the run of runes in class.  a rune
+// that isn't in class at the start of the run is a *RuneError.
+func (l *Lexer) ScanWhile(t TokenType, class func(rune) bool) (TokenType, string, error) {
+	return l.matchToken(t, l.rs, func(r rune) (bool, bool, error) {
+		if !class(r) {
+			return false, false, l.mismatch(r, fmt.Sprintf("a %v token", t))
+		}
+		return true, true, nil
+	})
+}
+
+// scanCustom offers the input at r to the registered scanners.  it reports
+// whether one of them took it.
+func (l *Lexer) scanCustom(r rune) (TokenType, string, bool, error) {
+	for _, s := range l.scanners {
+		if !s.predicate(r) {
+			continue
+		}
+		offset := l.rs.offset
+		t, value, err := s.scan(l)
+		if errors.Is(err, ErrClassMismatch) && l.rs.offset == offset {
+			continue
+		}
+		return t, value, true, err
+	}
+	return 0, "", false, nil
+}
@@ -0,0 +1,99 @@
+package lex
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+// tokenUUID is the type of the tokens scanUUID scans.  it is registered before
+// any test runs so every lexer made by the tests offers it the input.
+var tokenUUID TokenType
+
+func init() {
+	tokenUUID = RegisterScanner(isHexDigit, scanUUID)
+}
+
+func isHexDigit(r rune) bool {
+	return unicode.Is(unicode.ASCII_Hex_Digit, r)
+}
+
+// scanUUID scans a UUID such as 123e4567-e89b-12d3-a456-426614174000 that
+// is followed by white space or the end of the input.
+func scanUUID(l *Lexer) (TokenType, string, error) {
+	runes, _ := l.Peek(37)
+	if len(runes) < 36 || len(runes) == 37 && !unicode.IsSpace(runes[36]) {
+		return 0, "", ErrClassMismatch
+	}
+	for i, r := range runes[:36] {
+		switch i {
+		case 8, 13, 18, 23:
+			if r != '-' {
+				return 0, "", ErrClassMismatch
+			}
+		default:
+			if !isHexDigit(r) {
+				return 0, "", ErrClassMismatch
+			}
+		}
+	}
+	return l.ScanWhile(tokenUUID, func(r rune) bool { return isHexDigit(r) || r == '-' })
+}
+
+func TestRegisterScanner(t *testing.T) {
+	const uuid = "123e4567-e89b-12d3-a456-426614174000"
+
+	tests := map[string]struct {
+		input    string
+		expected []Token
+	}{
+		"Value": {
+			input:    "id=" + uuid + " n=12\n",
+			expected: []Token{{TokenAtom, "id"}, {TokenEqual, "="}, {tokenUUID, uuid}, {TokenWhiteSpace, " "}, {TokenAtom, "n"}, {TokenEqual, "="}, {TokenNumber, int64(12)}, {TokenNewLine, "\n"}},
+		},
+		"At EOF": {
+			input:    "id=" + uuid,
+			expected: []Token{{TokenAtom, "id"}, {TokenEqual, "="}, {tokenUUID, uuid}},
+		},
+		"Not Followed By Space": {
+			input:    "id=" + uuid + "x",
+			expected: []Token{{TokenAtom, "id"}, {TokenEqual, "="}, {TokenAtom, uuid + "x"}},
+		},
+		"Too Short": {
+			input:    "id=deadbeef",
+			expected: []Token{{TokenAtom, "id"}, {TokenEqual, "="}, {TokenAtom, "deadbeef"}},
+		},
+		"Number": {
+			input:    "n=42",
+			expected: []Token{{TokenAtom, "n"}, {TokenEqual, "="}, {TokenNumber, int64(42)}},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			lexer, err := NewLexer(WithReader(strings.NewReader(test.input)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := lexer.Tokens()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf(".Tokens() yielded %v; expected %v", got, test.expected)
+			}
+		})
+	}
+
+	if !tokenUUID.Custom() || TokenPriority.Custom() {
+		t.Fatalf("only %v should be a custom token type", tokenUUID)
+	}
+	if name := tokenUUID.String(); !strings.HasPrefix(name, "CUSTOM-") {
+		t.Fatalf("custom token type is named %q", name)
+	}
+}
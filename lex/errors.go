@@ -0,0 +1,47 @@
+package lex
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrClassMismatch is wrapped by a *RuneError when a scan method is asked to
+// scan a token its first rune can't start.
+var ErrClassMismatch = errors.New("rune does not belong to the token class")
+
+// ErrTruncatedUTF8 is held by the TokenError that ends lexing when the input
+// ends partway through a multi-byte UTF-8 sequence.
+var ErrTruncatedUTF8 = errors.New("input ends in a truncated UTF-8 sequence")
+
+// errEndOfToken ends a token at a rune that doesn't belong to it.  see
+// mismatch().
+var errEndOfToken = fmt.Errorf("end of token: %w", ErrClassMismatch)
+
+// RuneError reports a rune that isn't part of the class of token being scanned.
+// it matches ErrClassMismatch with errors.Is.
+type RuneError struct {
+	Rune rune
+	// Offset is the byte offset of Rune in the input.
+	Offset int64
+	// Class names the kind of token being scanned.
+	Class string
+}
+
+func (e *RuneError) Error() string {
+	return fmt.Sprintf("%q at offset %d is not part of %s", e.Rune, e.Offset, e.Class)
+}
+
+func (e *RuneError) Unwrap() error {
+	return ErrClassMismatch
+}
+
+// UnterminatedQuoteError reports a quoted string with no closing quote.
+type UnterminatedQuoteError struct {
+	Quote rune
+	// Offset is the byte offset of the opening quote in the input.
+	Offset int64
+}
+
+func (e *UnterminatedQuoteError) Error() string {
+	return fmt.Sprintf("string quoted with %c at offset %d is not terminated", e.Quote, e.Offset)
+}
@@ -0,0 +1,45 @@
+package lex
+
+// internLimit is the most lexemes WithInterner keeps.  past it, lexemes that
+// haven't been seen before are no longer added, so interning values that turn
+// out not to repeat can't grow the table without bound.
+const internLimit = 4096
+
+// WithInterner interns atoms and quoted strings in key position, so the keys
+// that repeat on every line share one string instead of each being allocated
+// anew.  values interns those in value position too, which pays off for values
+// with few distinct strings, such as levels.  the table is kept across Reset.
+func WithInterner(values bool) func(*Lexer) error {
+	return func(l *Lexer) error {
+		if l.interned == nil {
+			l.interned = make(map[string]string)
+		}
+		l.internValues = values
+		return nil
+	}
+}
+
+// internable reports whether the lexeme about to be matched may be interned.
+func (l *Lexer) internable() bool {
+	return l.interned != nil && (!l.sep || l.internValues)
+}
+
+// lexeme returns the lexeme match() gathered in buf.  when it is being
+// interned, a lexeme seen before is returned without allocating.
+func (l *Lexer) lexeme() string {
+	if !l.interning {
+		return string(l.buf)
+	}
+	l.interning = false
+
+	// the compiler doesn't allocate for a string conversion used only as a
+	// map index.
+	if s, exists := l.interned[string(l.buf)]; exists {
+		return s
+	}
+	s := string(l.buf)
+	if len(l.interned) < internLimit {
+		l.interned[s] = s
+	}
+	return s
+}
@@ -0,0 +1,30 @@
+package lex
+
+// Level selects how much is logged.  each level includes the ones before it.
+type Level int
+
+const (
+	// LevelError logs only errors that have nowhere else to go.
+	LevelError = Level(iota)
+	// LevelInfo also logs what became of malformed input.
+	LevelInfo
+	// LevelDebug also traces the lexer and parser token by token.  it is the
+	// default.
+	LevelDebug
+)
+
+// WithLogLevel sets how much is written to the logger.  everything the lexer
+// logs is a trace, so it logs nothing below LevelDebug.
+func WithLogLevel(level Level) func(*Lexer) error {
+	return func(l *Lexer) error {
+		l.level = level
+		return nil
+	}
+}
+
+// debugf logs a trace message at LevelDebug.
+func (l *Lexer) debugf(format string, args ...interface{}) {
+	if l.level >= LevelDebug {
+		l.log.Printf(format, args...)
+	}
+}
@@ -2,11 +2,16 @@ package lex
 
 import (
 	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"strconv"
 	"strings"
+	"time"
 	"unicode"
 	"unicode/utf8"
 )
@@ -22,15 +27,28 @@ const (
 	TokenQuotedString
 	TokenWhiteSpace
 	TokenUnidentified
+	TokenComment
+
+	// TokenEOF is the last token of input that was lexed to its end.  it has
+	// no value.  a stream that ends early, on an error or because its
+	// context was done, has no TokenEOF.
+	TokenEOF
+
+	// TokenPriority is the <PRI> that starts a syslog line, lexed with
+	// WithSyslogPriority.  its value is the priority as an int64.
+	TokenPriority
 )
 
 func (t TokenType) String() string {
 	m := map[TokenType]string{
 		TokenAtom:         "ATOM",
+		TokenComment:      "COMMENT",
+		TokenEOF:          "EOF",
 		TokenEqual:        "EQUAL",
 		TokenError:        "ERROR",
 		TokenNewLine:      "NEWLINE",
 		TokenNumber:       "NUMBER",
+		TokenPriority:     "PRIORITY",
 		TokenQuotedString: "QUOTED-STRING",
 		TokenUnidentified: "UNIDENTIFIED",
 		TokenWhiteSpace:   "WHITE-SPACE",
@@ -38,6 +56,9 @@ func (t TokenType) String() string {
 	if s, ok := m[t]; ok {
 		return s
 	}
+	if t.Custom() {
+		return fmt.Sprintf("CUSTOM-%d", t-firstCustom)
+	}
 	return "UNKNOWN"
 }
 
@@ -46,9 +67,106 @@ type Token struct {
 	Value interface{}
 }
 
+// MarshalJSON encodes the token as {"type":"ATOM","value":"foo"}, naming its
+// type as String() does.  values keep their json type, so a number is encoded
+// as a number; an error is encoded as its message.
+func (t Token) MarshalJSON() ([]byte, error) {
+	value := t.Value
+	if err, isErr := value.(error); isErr {
+		value = err.Error()
+	}
+	return json.Marshal(struct {
+		Type  string      `json:"type"`
+		Value interface{} `json:"value"`
+	}{t.Type.String(), value})
+}
+
+// ErrTokenTooLong is returned when a lexeme grows beyond the limit set with
+// WithMaxTokenLength.
+var ErrTokenTooLong = errors.New("token exceeds maximum length")
+
 type Lexer struct {
-	rs  io.RuneScanner
-	log *log.Logger
+	rs    *pushback
+	r     io.Reader
+	log   *log.Logger
+	level Level
+
+	// maxTokenLength is the most runes a single lexeme may hold.  zero means
+	// unlimited.
+	maxTokenLength int
+
+	// commentPrefix starts a comment that runs to the end of the line.  it is
+	// empty when comments aren't recognized.
+	commentPrefix []rune
+
+	// multilineQuotes allows a quoted string to contain newlines.
+	multilineQuotes bool
+
+	// separator divides a key from its value.
+	separator rune
+
+	// buf holds the lexeme being matched.  started is set once match() is
+	// past the first rune of it.
+	buf     []byte
+	started bool
+
+	// delimiter ends a record.  it is scanned as a TokenNewLine.
+	delimiter rune
+
+	// sep is true when the last token scanned was a separator, meaning the
+	// next token is in value position.
+	sep bool
+
+	// spacedSeparator keeps sep set across white space after a separator.
+	spacedSeparator bool
+
+	// rawNumbers leaves the values of number tokens as they were written.
+	rawNumbers bool
+
+	// bufferSize is the size of the buffer read through when the reader
+	// isn't an io.RuneScanner.  zero means bufio's default.
+	bufferSize int
+
+	// forceBuffering reads through a buffer even if the reader is an
+	// io.RuneScanner.
+	forceBuffering bool
+
+	// tabSeparated lets values hold spaces, leaving tabs to separate pairs.
+	tabSeparated bool
+
+	// rawBackslash keeps every backslash as it is, in atoms and quoted
+	// strings alike.
+	rawBackslash bool
+
+	// readTimeout is the longest a single read of the input may take.  zero
+	// means unlimited.
+	readTimeout time.Duration
+
+	// syslogPriority lexes a <PRI> at the start of a line as a
+	// TokenPriority.  lineStart is true until the first token of a line has
+	// been scanned.
+	syslogPriority bool
+	lineStart      bool
+
+	// interned maps each lexeme interned so far to its one copy.  it is nil
+	// unless WithInterner was given.  internValues interns lexemes in value
+	// position as well as keys, and interning is set while an atom or quoted
+	// string that may be interned is matched.
+	interned     map[string]string
+	internValues bool
+	interning    bool
+
+	// scanners are the scanners registered with RegisterScanner when the
+	// lexer was made.
+	scanners []scanner
+
+	// quotes maps the runes that open the quote pairs added with
+	// WithQuoteRunes to the runes that close them.
+	quotes map[rune]rune
+
+	// err is the error that ended lexing.  it is written before the channel
+	// returned by Lex() is closed.
+	err error
 }
 
 func WithLogger(lggr *log.Logger) func(*Lexer) error {
@@ -58,27 +176,201 @@ func WithLogger(lggr *log.Logger) func(*Lexer) error {
 	}
 }
 
-func runeScanner(r io.Reader) (io.RuneScanner, error) {
-	if rs, isRuneScanner := r.(io.RuneScanner); isRuneScanner {
-		return rs, nil
+// WithMaxTokenLength limits the number of runes in a single lexeme to n.  a
+// longer lexeme ends lexing with a TokenError holding ErrTokenTooLong, which
+// keeps input without separators (such as a binary file) from growing a token
+// without bound.  the default of zero means unlimited.
+func WithMaxTokenLength(n int) func(*Lexer) error {
+	return func(l *Lexer) error {
+		if n < 0 {
+			return fmt.Errorf("maximum token length must not be negative; got %d", n)
+		}
+		l.maxTokenLength = n
+		return nil
+	}
+}
+
+// WithCommentPrefix makes a token that starts with prefix, such as "#" or
+// "//", a comment running to the end of the line.  comments are emitted as
+// TokenComment.  by default there are no comments.
+func WithCommentPrefix(prefix string) func(*Lexer) error {
+	return func(l *Lexer) error {
+		l.commentPrefix = []rune(prefix)
+		return nil
 	}
-	return bufio.NewReader(r), nil
 }
 
-func WithReader(r io.Reader) func(*Lexer) error {
+// WithMultilineQuotes allows quoted strings to contain literal newlines.  by
+// default a newline before the closing quote makes the string unterminated.
+func WithMultilineQuotes(multiline bool) func(*Lexer) error {
 	return func(l *Lexer) error {
-		rs, err := runeScanner(r)
-		if err != nil {
-			return err
+		l.multilineQuotes = multiline
+		return nil
+	}
+}
+
+// WithSpacedSeparator allows white space between a separator and its value,
+// as in key= value.  the value is still lexed as a value, so it may hold
+// separators of its own.
+func WithSpacedSeparator(spaced bool) func(*Lexer) error {
+	return func(l *Lexer) error {
+		l.spacedSeparator = spaced
+		return nil
+	}
+}
+
+// WithRawNumbers makes the value of a TokenNumber the string it was lexed
+// from, such as "0x1F" or "1.0", rather than the int64 or float64 it stands
+// for.  ParseNumber types it later if need be.
+func WithRawNumbers(raw bool) func(*Lexer) error {
+	return func(l *Lexer) error {
+		l.rawNumbers = raw
+		return nil
+	}
+}
+
+// WithTabAsSeparator is for logs whose pairs are separated by tabs rather
+// than spaces.  a value then runs up to the next tab, so key=multi word
+// value\tkey2=x holds two pairs with no need for quotes.  a value still can't
+// start with a space, and spaces outside of values are white space as usual.
+func WithTabAsSeparator(tabs bool) func(*Lexer) error {
+	return func(l *Lexer) error {
+		l.tabSeparated = tabs
+		return nil
+	}
+}
+
+// WithRawBackslash keeps every backslash as the literal rune it is, as the
+// paths in Windows logs need.  by default a few backslashes are escapes: one
+// before a separator or space in an atom (see escapable()) and any in a single
+// or double quoted string.  most paths come through untouched anyway, but
+// path=C:\dir\ n=1 would otherwise escape the space and "C:\dir\" the closing
+// quote.  a quoted string then can't hold its own quote.
+func WithRawBackslash(raw bool) func(*Lexer) error {
+	return func(l *Lexer) error {
+		l.rawBackslash = raw
+		return nil
+	}
+}
+
+// WithSeparator makes r, rather than '=', divide keys from values.  the
+// separator can't be white space or a quote.
+func WithSeparator(r rune) func(*Lexer) error {
+	return func(l *Lexer) error {
+		if unicode.IsSpace(r) || l.quoteRune(r) || !unicode.IsPrint(r) || r == l.delimiter {
+			return fmt.Errorf("%q cannot be used as a separator", r)
+		}
+		l.separator = r
+		return nil
+	}
+}
+
+// WithQuoteRunes adds a pair of quotes, such as '[' and ']' or typographic
+// quotes, to the double quotes, single quotes and backticks that quote
+// strings.  a string opened with open is closed by close alone, so [a [b] holds
+// "a [b".  backslashes escape within it as they do within double quotes.  it
+// may be given more than once for several pairs.
+func WithQuoteRunes(open, close rune) func(*Lexer) error {
+	return func(l *Lexer) error {
+		for _, r := range []rune{open, close} {
+			if unicode.IsSpace(r) || !unicode.IsPrint(r) || r == '\\' || r == l.separator || r == l.delimiter {
+				return fmt.Errorf("%q cannot be used as a quote", r)
+			}
+		}
+		if quoteRune(open) {
+			return fmt.Errorf("%q is already a quote", open)
+		}
+		if l.quotes == nil {
+			l.quotes = make(map[rune]rune)
+		}
+		l.quotes[open] = close
+		return nil
+	}
+}
+
+// WithRecordDelimiter makes r, rather than '\n', end a record.  r is scanned
+// as a TokenNewLine and newlines become white space, so records delimited by
+// NULs (as from find -print0) may span lines.
+func WithRecordDelimiter(r rune) func(*Lexer) error {
+	return func(l *Lexer) error {
+		if l.quoteRune(r) || r == l.separator {
+			return fmt.Errorf("%q cannot be used as a record delimiter", r)
+		}
+		l.delimiter = r
+		return nil
+	}
+}
+
+// WithBufferSize reads the input through a buffer of n bytes rather than the
+// bufio default of 4KB, which saves reads on long lines and busy streams.  it
+// has no effect if the reader is an io.RuneScanner, since that is read from
+// directly, unless WithForceBuffering is given too.
+func WithBufferSize(n int) func(*Lexer) error {
+	return func(l *Lexer) error {
+		if n <= 0 {
+			return fmt.Errorf("buffer size must be positive; got %d", n)
+		}
+		l.bufferSize = n
+
+		// the reader may have been given first.
+		if l.r != nil {
+			l.setReader(l.r)
+		}
+		return nil
+	}
+}
+
+// WithForceBuffering reads the input through a bufio.Reader even if it is
+// already an io.RuneScanner.  by default an io.RuneScanner is read from
+// directly, which suits a strings.Reader but not one whose every ReadRune is
+// costly, such as one that locks or makes a system call.
+func WithForceBuffering(force bool) func(*Lexer) error {
+	return func(l *Lexer) error {
+		l.forceBuffering = force
+
+		// the reader may have been given first.
+		if l.r != nil {
+			l.setReader(l.r)
 		}
-		l.rs = rs
+		return nil
+	}
+}
+
+// runeScanner returns r as the io.RuneScanner the lexer reads through.  unless
+// WithForceBuffering was given, an io.RuneScanner is read from directly.
+func (l *Lexer) runeScanner(r io.Reader) *pushback {
+	if l.readTimeout > 0 {
+		r = newTimeoutReader(r, l.readTimeout)
+	}
+	if rs, isRuneScanner := r.(io.RuneScanner); isRuneScanner && !l.forceBuffering {
+		return newPushback(rs)
+	}
+	if l.bufferSize > 0 {
+		return newPushback(bufio.NewReaderSize(r, l.bufferSize))
+	}
+	return newPushback(bufio.NewReader(r))
+}
+
+// setReader makes r the input.
+func (l *Lexer) setReader(r io.Reader) {
+	l.r, l.rs = r, l.runeScanner(r)
+}
+
+func WithReader(r io.Reader) func(*Lexer) error {
+	return func(l *Lexer) error {
+		l.setReader(r)
 		return nil
 	}
 }
 
 func NewLexer(opts ...func(*Lexer) error) (*Lexer, error) {
 	lexer := Lexer{
-		log: log.New(ioutil.Discard, "", 0),
+		log:       log.New(ioutil.Discard, "", 0),
+		level:     LevelDebug,
+		separator: '=',
+		delimiter: '\n',
+		lineStart: true,
+		scanners:  registered(),
 	}
 	for _, opt := range opts {
 		if err := opt(&lexer); err != nil {
@@ -88,6 +380,15 @@ func NewLexer(opts ...func(*Lexer) error) (*Lexer, error) {
 	return &lexer, nil
 }
 
+// Reset prepares the lexer to scan r, discarding any state left over from the
+// previous input.  the logger and other options are kept.  Reset must not be
+// called while a channel returned by Lex() is still being drained.
+func (l *Lexer) Reset(r io.Reader) error {
+	l.setReader(r)
+	l.sep, l.lineStart, l.err = false, true, nil
+	return nil
+}
+
 func (l *Lexer) peek() (rune, error) {
 	r, _, err := l.rs.ReadRune()
 	l.rs.UnreadRune()
@@ -97,6 +398,28 @@ func (l *Lexer) peek() (rune, error) {
 	return r, nil
 }
 
+// peekN returns up to the next n runes without consuming them.  if the input
+// ends first, the runes that were available are returned along with the error
+// that ended them.
+func (l *Lexer) peekN(n int) ([]rune, error) {
+	runes := make([]rune, 0, n)
+	sizes := make([]int, 0, n)
+	var err error
+	for len(runes) < n {
+		r, size, readErr := l.rs.ReadRune()
+		if readErr != nil {
+			err = readErr
+			break
+		}
+		runes, sizes = append(runes, r), append(sizes, size)
+	}
+
+	for i := len(runes) - 1; i >= 0; i-- {
+		l.rs.push(runes[i], sizes[i])
+	}
+	return runes, err
+}
+
 // match() scans an io.RuneScanner and calls matchFunc() for every rune read.
 // this is the core of this package.
 //
@@ -123,22 +446,35 @@ func (l *Lexer) peek() (rune, error) {
 // can maintain state outside of the matchFunc().
 //
 func (l *Lexer) match(rs io.RuneScanner, matchFunc func(rune) (bool, bool, error)) (string, error) {
-	lexeme := &strings.Builder{}
+	// the lexeme is gathered in a buffer that is reused from token to token,
+	// so the only allocation left is the string returned.
+	l.buf = l.buf[:0]
 	var matchErr error
-	for {
+	length := 0
+	for first := true; ; first = false {
 		r, _, err := rs.ReadRune()
 		if err != nil {
 			matchErr = err
 			break
 		}
 
+		l.started = !first
 		accept, cont, err := matchFunc(r)
 		if accept {
-			lexeme.WriteRune(r)
+			if length++; l.maxTokenLength > 0 && length > l.maxTokenLength {
+				matchErr = ErrTokenTooLong
+				break
+			}
+			l.buf = appendRune(l.buf, r)
 		}
 
 		if err != nil {
 			rs.UnreadRune()
+			// a token that can't even start with the rune we were given
+			// is an error in its own right.
+			if first {
+				matchErr = err
+			}
 			break
 		}
 
@@ -146,7 +482,29 @@ func (l *Lexer) match(rs io.RuneScanner, matchFunc func(rune) (bool, bool, error
 			break
 		}
 	}
-	return lexeme.String(), matchErr
+	return l.lexeme(), matchErr
+}
+
+func appendRune(b []byte, r rune) []byte {
+	if r < utf8.RuneSelf {
+		return append(b, byte(r))
+	}
+	var enc [utf8.UTFMax]byte
+	n := utf8.EncodeRune(enc[:], r)
+	return append(b, enc[:n]...)
+}
+
+// mismatch returns the error for r, the rune just read, not belonging to
+// class.
+//
+// match() only reports a mismatch on the first rune of a token; past that it
+// simply ends the token.  those errors are never seen, so a shared one is
+// returned instead of allocating.
+func (l *Lexer) mismatch(r rune, class string) error {
+	if l.started {
+		return errEndOfToken
+	}
+	return &RuneError{Rune: r, Offset: l.rs.lastOffset, Class: class}
 }
 
 func (l *Lexer) matchToken(t TokenType, rs io.RuneScanner, matchFunc func(rune) (bool, bool, error)) (TokenType, string, error) {
@@ -156,112 +514,314 @@ func (l *Lexer) matchToken(t TokenType, rs io.RuneScanner, matchFunc func(rune)
 
 func (l *Lexer) ScanUnidentified() (TokenType, string, error) {
 	return l.matchToken(TokenUnidentified, l.rs, func(r rune) (bool, bool, error) {
-		v := r != '\n' && !unicode.IsSpace(r)
+		v := r != l.delimiter && !unicode.IsSpace(r)
 		if !v {
-			return v, v, fmt.Errorf("%c is not part of an unidentified", r)
+			return v, v, l.mismatch(r, "an unidentified token")
 		}
 		return v, v, nil
 	})
 }
 
+func quoteRune(r rune) bool {
+	return r == '"' || r == '\'' || r == '`'
+}
+
+// quoteRune reports whether r opens a quoted string, either as one of the
+// usual quotes or as a pair added with WithQuoteRunes.
+func (l *Lexer) quoteRune(r rune) bool {
+	if quoteRune(r) {
+		return true
+	}
+	_, isQuote := l.quotes[r]
+	return isQuote
+}
+
+// closeQuote returns the rune that closes a string opened with r.
+func (l *Lexer) closeQuote(r rune) rune {
+	if end, isPair := l.quotes[r]; isPair {
+		return end
+	}
+	return r
+}
+
+// ScanQuotedString scans a string delimited by double quotes, single quotes,
+// backticks or a pair added with WithQuoteRunes.  within double and single
+// quotes, and added pairs, a backslash escapes the rune that follows it.
+// backticks quote raw strings: their contents are taken literally.
 func (l *Lexer) ScanQuotedString() (TokenType, string, error) {
 	count := 0
-	var endQuote rune
-	var escaped bool
-	return l.matchToken(TokenAtom, l.rs, func(r rune) (bool, bool, error) {
+	var quote, endQuote rune
+	var escaped, closed, brokenLine bool
+	var start int64
+	l.interning = l.internable()
+	t, s, err := l.matchToken(TokenQuotedString, l.rs, func(r rune) (bool, bool, error) {
 		count++
 		if escaped {
 			escaped = false
 			return true, true, nil
 		}
 
-		if count == 1 && (r == '"' || r == '\'') {
-			if r == '"' {
-				l.log.Printf("HANDLING DOUBLE QUOTED STRING")
-			} else {
-				l.log.Printf("HANDLING SINGLE QUOTED STRING")
+		if count == 1 && l.quoteRune(r) {
+			switch r {
+			case '"':
+				l.debugf("HANDLING DOUBLE QUOTED STRING")
+			case '`':
+				l.debugf("HANDLING RAW QUOTED STRING")
+			case '\'':
+				l.debugf("HANDLING SINGLE QUOTED STRING")
+			default:
+				l.debugf("HANDLING STRING QUOTED WITH %c", r)
 			}
-			endQuote = r
+			// a pair such as [...] closes with a rune of its own.
+			quote, endQuote, start = r, l.closeQuote(r), l.rs.lastOffset
 			// don't accept this rune but continue without error
 			return false, true, nil
 		}
 
 		// if it is an escape sentinel, continue but don't accept it
-		if r == '\\' && !escaped {
+		if r == '\\' && !escaped && quote != '`' && !l.rawBackslash {
 			escaped = true
 			return false, true, nil
 		}
 
-		if r == endQuote || r == '\n' {
-			l.log.Printf("GOT ENDING QUOTE RUNE (%c)", r)
+		if r == endQuote {
+			l.debugf("GOT ENDING QUOTE RUNE (%c)", r)
+			closed = true
 			return false, false, nil
 		}
+
+		// leave the newline in the stream so the line still ends.
+		if r == l.delimiter && !l.multilineQuotes {
+			brokenLine = true
+			return false, false, l.mismatch(r, "a single line quoted string")
+		}
 		return true, true, nil
 	})
+
+	if (err == io.EOF || brokenLine) && !closed && count > 0 {
+		return t, s, &UnterminatedQuoteError{Quote: quote, Offset: start}
+	}
+	return t, s, err
 }
 
 func (l *Lexer) ScanNewLine() (TokenType, string, error) {
 	return l.matchToken(TokenNewLine, l.rs, func(r rune) (bool, bool, error) {
-		v := r == '\n'
+		// a newline is always a single rune.  continuing to look for more
+		// would block on a live stream until the next line arrives.
+		v := r == l.delimiter
 		if !v {
-			return v, false, fmt.Errorf("did not scan a newline")
+			return v, false, l.mismatch(r, "a newline")
 		}
-		return v, v, nil
+		return v, false, nil
 	})
 }
 
 func (l *Lexer) ScanEqual() (TokenType, string, error) {
 	return l.matchToken(TokenEqual, l.rs, func(r rune) (bool, bool, error) {
-		v := r == '='
+		v := r == l.separator
 		if !v {
-			return v, v, fmt.Errorf("did not scan an equal sign")
+			return v, v, l.mismatch(r, "a separator")
 		}
-		return v, v, nil
+		// only a single separator counts.  any that follow belong to the
+		// value.
+		return v, false, nil
 
 	})
 }
 
+// ScanWhiteSpace scans a run of white space other than the record delimiter.
+// however its spaces, tabs and carriage returns are mixed, a run is a single
+// token whose value is the run exactly as it appeared, so tools that reformat
+// input can write it back unchanged.
 func (l *Lexer) ScanWhiteSpace() (TokenType, string, error) {
 	return l.matchToken(TokenWhiteSpace, l.rs, func(r rune) (bool, bool, error) {
-		v := r != '\n' && unicode.IsSpace(r)
+		v := r != l.delimiter && unicode.IsSpace(r)
 		if !v {
-			return v, v, fmt.Errorf("%c is not a whitespace charater", r)
+			return v, v, l.mismatch(r, "white space")
 		}
 		return v, v, nil
 	})
 }
 
-func atomClass(r rune) bool {
-	return r != '\n' && r != '=' && unicode.IsPrint(r) && !unicode.IsSpace(r)
+func (l *Lexer) atomClass(r rune) bool {
+	return r != l.delimiter && r != l.separator && unicode.IsPrint(r) && !unicode.IsSpace(r)
 }
 
+// valueClass is the class of runes in an atom that follows a separator.  once
+// we're past the key only white space ends the value: separators are data
+// rather than structure, so values like token=YWJj== keep their padding and
+// url=http://host/path?a=1&b=2 keeps its query string.  other than that it
+// is the atom class, so a control character is still unidentified input.
+// with WithTabAsSeparator a space doesn't end the value either.
+func (l *Lexer) valueClass(r rune) bool {
+	return l.atomClass(r) || r == l.separator || l.tabSeparated && r == ' '
+}
+
+// ScanAtom scans a run of atom class runes.  if the previous token was a
+// separator the atom is a value and may also contain the separator.  a
+// backslash escapes a separator or space that follows it; see escapable().
 func (l *Lexer) ScanAtom() (TokenType, string, error) {
-	return l.matchToken(TokenAtom, l.rs, func(r rune) (bool, bool, error) {
-		v := atomClass(r)
+	return l.scanRun(TokenAtom)
+}
+
+func (l *Lexer) scanRun(t TokenType) (TokenType, string, error) {
+	class := l.atomClass
+	if l.sep {
+		class = l.valueClass
+	}
+	escaped := false
+	l.interning = l.internable()
+	return l.matchToken(t, l.rs, func(r rune) (bool, bool, error) {
+		if escaped {
+			escaped = false
+			return true, true, nil
+		}
+		if r == '\\' && l.escapable() {
+			escaped = true
+			return false, true, nil
+		}
+
+		v := class(r)
 		if !v {
-			return v, v, fmt.Errorf("%c is not in the atom class", r)
+			return v, v, l.mismatch(r, "an atom")
 		}
 		return v, v, nil
 	})
 }
 
+// escapable reports whether the next rune may be escaped with a backslash in
+// an atom.  only the separator and a space can be, giving a way to write them
+// without quotes: a\=b is the atom a=b and a\ b is a b.  any other backslash
+// is kept as is, so paths such as C:\logs come through untouched.  with
+// WithRawBackslash nothing is.
+func (l *Lexer) escapable() bool {
+	if l.rawBackslash {
+		return false
+	}
+	r, err := l.peek()
+	return err == nil && (r == l.separator || r == ' ')
+}
+
+// ScanComment scans everything up to, but not including, the next newline.
+func (l *Lexer) ScanComment() (TokenType, string, error) {
+	return l.matchToken(TokenComment, l.rs, func(r rune) (bool, bool, error) {
+		if r == l.delimiter {
+			return false, false, l.mismatch(r, "a comment")
+		}
+		return true, true, nil
+	})
+}
+
+// atComment reports whether the input, which continues with r, continues with
+// the comment prefix.  the rest of the prefix is only peeked at once r starts
+// it, so a newline isn't held up waiting for runes of the next line.
+func (l *Lexer) atComment(r rune) bool {
+	if len(l.commentPrefix) == 0 || r != l.commentPrefix[0] {
+		return false
+	}
+	runes, _ := l.peekN(len(l.commentPrefix))
+	return string(runes) == string(l.commentPrefix)
+}
+
+func digit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+// ScanNumber scans a run of atom runes that starts with a digit.  the run is
+// only a number if the whole of it parses as one (see number()), so values
+// such as timestamps and dotted versions that merely start with a digit are
+// still atoms.
+func (l *Lexer) ScanNumber() (TokenType, string, error) {
+	return l.scanRun(TokenNumber)
+}
+
+// number converts the lexeme of a TokenNumber to an int64 or, failing that, a
+// float64.  a lexeme that is neither (such as "1.2.3") is demoted to an atom.
+//
+// integers may also be written in hex (0x), octal (0o) or binary (0b).  a
+// leading zero alone does not make an integer octal: 0755 is 755, since zero
+// padded decimals are far more common in logs than C style octal.
+func number(s string) (TokenType, interface{}) {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return TokenNumber, i
+	}
+	if basePrefixed(s) {
+		if i, err := strconv.ParseInt(s, 0, 64); err == nil {
+			return TokenNumber, i
+		}
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return TokenNumber, f
+	}
+	return TokenAtom, s
+}
+
+// ParseNumber returns s as the int64 or float64 the lexer types it as.  it
+// reports false if s isn't a number.
+func ParseNumber(s string) (interface{}, bool) {
+	tokenType, typed := number(s)
+	return typed, tokenType == TokenNumber
+}
+
+// basePrefixed reports whether s is an integer with a 0x, 0o or 0b prefix.
+// the underscores strconv allows between digits are not accepted.
+func basePrefixed(s string) bool {
+	if len(s) < 3 || s[0] != '0' || strings.ContainsRune(s, '_') {
+		return false
+	}
+	switch s[1] {
+	case 'x', 'X', 'o', 'O', 'b', 'B':
+		return true
+	}
+	return false
+}
+
+// byteOrderMark is the rune some windows tools begin utf-8 files with.
+const byteOrderMark = '\uFEFF'
+
+// skipBOM drops a byte order mark from the very start of the input, where it
+// would otherwise be glued onto the first key.
+func (l *Lexer) skipBOM() {
+	if l.rs.offset != 0 {
+		return
+	}
+	if r, err := l.peek(); err == nil && r == byteOrderMark {
+		l.rs.ReadRune()
+	}
+}
+
 func (l *Lexer) scan() (*Token, error) {
+	l.skipBOM()
+
 	classify := func() (TokenType, string, error) {
 		r, err := l.peek()
-		l.log.Printf("PEEKED AT %[1]c (%[1]d)", r)
+		l.debugf("PEEKED AT %[1]c (%[1]d)", r)
 		if err != nil {
-			return TokenError, err.Error(), err
+			return TokenError, "", err
 		}
 		switch {
-		case unicode.IsSpace(r) && r != '\n':
+		case l.syslogPriority && l.lineStart && l.atPriority(r):
+			return l.ScanPriority()
+		case l.atComment(r):
+			return l.ScanComment()
+		case unicode.IsSpace(r) && r != l.delimiter:
 			return l.ScanWhiteSpace()
-		case r == '\n':
+		case r == l.delimiter:
 			return l.ScanNewLine()
-		case r == '\'' || r == '"':
+		case l.quoteRune(r):
 			return l.ScanQuotedString()
-		case r == '=':
+		case r == l.separator && !l.sep:
 			return l.ScanEqual()
-		case atomClass(r):
+		}
+
+		if t, value, ok, err := l.scanCustom(r); ok {
+			return t, value, err
+		}
+
+		switch {
+		case digit(r):
+			return l.ScanNumber()
+		case l.atomClass(r) || l.sep && l.valueClass(r):
 			return l.ScanAtom()
 		default:
 			return l.ScanUnidentified()
@@ -269,25 +829,158 @@ func (l *Lexer) scan() (*Token, error) {
 	}
 
 	tokenType, value, err := classify()
+
+	// a lexeme that was cut short by the end of input is still a complete
+	// token.  the EOF will be reported by the next call to scan().
+	if err == io.EOF && value != "" {
+		err = nil
+	}
+
 	if err != nil {
 		return &Token{Type: TokenError, Value: err}, err
 	}
+
+	if !(l.sep && l.spacedSeparator && tokenType == TokenWhiteSpace) {
+		l.sep = tokenType == TokenEqual
+	}
+	l.lineStart = tokenType == TokenNewLine
+
+	if tokenType == TokenPriority {
+		pri, _ := strconv.ParseInt(value, 10, 64)
+		return &Token{Type: tokenType, Value: pri}, nil
+	}
+
+	if tokenType == TokenNumber {
+		tokenType, typed := number(value)
+		if l.rawNumbers {
+			typed = value
+		}
+		return &Token{Type: tokenType, Value: typed}, nil
+	}
 	return &Token{Type: tokenType, Value: value}, nil
 }
 
-func (l *Lexer) lex(tch chan<- Token) {
-	for {
+// lex scans the input, passing each token to send until send reports false,
+// which it does once ctx is done.  the error that ends it is kept for Err().
+func (l *Lexer) lex(ctx context.Context, send func(Token) bool) {
+	l.err = nil
+	for ctx.Err() == nil {
 		val, err := l.scan()
 		if err != nil {
+			if err == io.EOF {
+				send(Token{Type: TokenEOF})
+				return
+			}
+
+			if !send(*val) {
+				break
+			}
+
+			// an unterminated quote spoils only its own line.  anything else
+			// means we can't go on.
+			if _, isQuote := err.(*UnterminatedQuoteError); isQuote {
+				continue
+			}
+			l.err = err
+			return
+		}
+		l.debugf("val: %v", val)
+		if !send(*val) {
 			break
 		}
-		l.log.Printf("val: %q", val)
-		tch <- *val
 	}
+	l.err = ctx.Err()
+}
+
+// Err returns the error that ended the tokens of the last Lex(), LexContext()
+// or Tokens(): nil if the input was lexed to its end, the error held by the
+// TokenError lexing stopped at, such as a failed read, or the context's error
+// if it was done first.  an unterminated quote doesn't end lexing and so isn't
+// returned.
+//
+// the error is set before the channel returned by Lex() is closed, so Err() is
+// only safe to call once that channel has been drained.
+func (l *Lexer) Err() error {
+	return l.err
 }
 
 func (l *Lexer) Lex() <-chan Token {
+	return l.LexContext(context.Background())
+}
+
+// LexContext is like Lex() but stops scanning, and closes the channel, once ctx
+// is done.  this lets a consumer that stops reading early release the
+// goroutine doing the scanning.  ctx is checked between tokens, so a read that
+// is already blocked in the underlying reader runs until it returns.
+func (l *Lexer) LexContext(ctx context.Context) <-chan Token {
 	tch := make(chan Token)
-	go func() { l.lex(tch); close(tch) }()
+	send := func(tok Token) bool {
+		select {
+		case tch <- tok:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	go func() { l.lex(ctx, send); close(tch) }()
 	return tch
 }
+
+// ScanLine scans the next line of input and returns its tokens, up to and
+// including the TokenNewLine that ends it.  it is a pull based alternative to
+// Lex() for consumers that want to work a line at a time.
+//
+// like bufio.Reader's ReadString, it returns io.EOF along with the tokens of
+// the last line, which then end in a TokenEOF rather than a TokenNewLine.  an
+// unterminated quote spoils only its own line: the rest of the line is still
+// scanned and returned along with the UnterminatedQuoteError, so ScanLine can
+// be called again for the next one.  any other error ends the tokens returned
+// with a TokenError.
+func (l *Lexer) ScanLine() ([]Token, error) {
+	var toks []Token
+	var lineErr error
+	for {
+		tok, err := l.scan()
+		if err == io.EOF {
+			if lineErr != nil {
+				err = lineErr
+			}
+			return append(toks, Token{Type: TokenEOF}), err
+		}
+		toks = append(toks, *tok)
+		if err != nil {
+			if _, isQuote := err.(*UnterminatedQuoteError); !isQuote {
+				return toks, err
+			}
+			if lineErr == nil {
+				lineErr = err
+			}
+			continue
+		}
+		l.debugf("val: %v", tok)
+		if tok.Type == TokenNewLine {
+			return toks, lineErr
+		}
+	}
+}
+
+// Tokens scans the rest of the input and returns its tokens as a slice, along
+// with the error held by the first TokenError.  the TokenEOF that ends a clean
+// stream is left off.  it is meant for tests and small inputs.
+func (l *Lexer) Tokens() ([]Token, error) {
+	var toks []Token
+	var err error
+	l.lex(context.Background(), func(tok Token) bool {
+		switch tok.Type {
+		case TokenEOF:
+			return true
+		case TokenError:
+			if err == nil {
+				err, _ = tok.Value.(error)
+			}
+		}
+		toks = append(toks, tok)
+		return true
+	})
+	return toks, err
+}
@@ -1,9 +1,18 @@
 package lex
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"net"
+	"reflect"
 	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 )
 
 func TestLex(t *testing.T) {
@@ -65,6 +74,8 @@ func TestScanQuotedString(t *testing.T) {
 		"Multi Word, Single Quote":   {input: `'this is a test'`, expected: "this is a test"},
 		"Multi Word, Escaped Quotes": {input: `'this \'is\' a test'`, expected: "this 'is' a test"},
 		"Escaped Quotes":             {input: `'\'\'\'\'\''`, expected: `'''''`},
+		"Backtick, Embedded Quotes":  {input: "`echo \"hi\" 'there'`", expected: `echo "hi" 'there'`},
+		"Backtick, Raw Backslash":    {input: "`C:\\logs\\`", expected: `C:\logs\`},
 	}
 
 	for name, test := range tests {
@@ -130,3 +141,1335 @@ func TestScanAtom(t *testing.T) {
 		})
 	}
 }
+
+func TestSeparatorInValue(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		expected []Token
+	}{
+		"Padded Value": {
+			input:    `key=YWJj==`,
+			expected: []Token{{TokenAtom, "key"}, {TokenEqual, "="}, {TokenAtom, "YWJj=="}, {TokenEOF, nil}},
+		},
+		"Value Of Equals": {
+			input:    `key===`,
+			expected: []Token{{TokenAtom, "key"}, {TokenEqual, "="}, {TokenAtom, "=="}, {TokenEOF, nil}},
+		},
+		"URL": {
+			input:    `url=http://h/p?a=1&b=2`,
+			expected: []Token{{TokenAtom, "url"}, {TokenEqual, "="}, {TokenAtom, "http://h/p?a=1&b=2"}, {TokenEOF, nil}},
+		},
+		"Control Characters": {
+			input:    "a=x\x01y",
+			expected: []Token{{TokenAtom, "a"}, {TokenEqual, "="}, {TokenAtom, "x"}, {TokenUnidentified, "\x01y"}, {TokenEOF, nil}},
+		},
+		"Next Key": {
+			input:    `a=b= c=d`,
+			expected: []Token{{TokenAtom, "a"}, {TokenEqual, "="}, {TokenAtom, "b="}, {TokenWhiteSpace, " "}, {TokenAtom, "c"}, {TokenEqual, "="}, {TokenAtom, "d"}, {TokenEOF, nil}},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			lexer, err := NewLexer(WithReader(strings.NewReader(test.input)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := []Token{}
+			for tok := range lexer.Lex() {
+				got = append(got, tok)
+			}
+
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("lexing %q yielded %v; expected %v", test.input, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestReset(t *testing.T) {
+	lexer, err := NewLexer(WithReader(strings.NewReader(`a=`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lexAll := func() []Token {
+		toks := []Token{}
+		for tok := range lexer.Lex() {
+			toks = append(toks, tok)
+		}
+		return toks
+	}
+
+	if got, expected := lexAll(), []Token{{TokenAtom, "a"}, {TokenEqual, "="}, {TokenEOF, nil}}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("first input yielded %v; expected %v", got, expected)
+	}
+
+	// the first input ended just after a separator.  that must not make the
+	// start of the next input scan as a value.
+	if err := lexer.Reset(strings.NewReader(`=b`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, expected := lexAll(), []Token{{TokenEqual, "="}, {TokenAtom, "b"}, {TokenEOF, nil}}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("second input yielded %v; expected %v", got, expected)
+	}
+}
+
+// TestDottedValues checks that a value with more dots than a number can hold,
+// such as a version or an IP address, is a single atom rather than a number
+// followed by the rest.
+func TestDottedValues(t *testing.T) {
+	lexer, err := NewLexer(WithReader(strings.NewReader("v=1.2.3 ip=10.0.0.1 n=1.2")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := lexer.Tokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Token{
+		{TokenAtom, "v"}, {TokenEqual, "="}, {TokenAtom, "1.2.3"}, {TokenWhiteSpace, " "},
+		{TokenAtom, "ip"}, {TokenEqual, "="}, {TokenAtom, "10.0.0.1"}, {TokenWhiteSpace, " "},
+		{TokenAtom, "n"}, {TokenEqual, "="}, {TokenNumber, 1.2},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf(".Tokens() yielded %v; expected %v", got, expected)
+	}
+}
+
+func TestScanNumber(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		expected Token
+	}{
+		"Integer":            {input: `42`, expected: Token{TokenNumber, int64(42)}},
+		"Float":              {input: `4.2`, expected: Token{TokenNumber, 4.2}},
+		"Exponent":           {input: `1e3`, expected: Token{TokenNumber, 1000.0}},
+		"Timestamp Is Atom":  {input: `2023-01-02T15:04:05Z`, expected: Token{TokenAtom, "2023-01-02T15:04:05Z"}},
+		"Suffix Is Atom":     {input: `500ms`, expected: Token{TokenAtom, "500ms"}},
+		"Hex":                {input: `0xFF`, expected: Token{TokenNumber, int64(255)}},
+		"Upper Hex":          {input: `0XfF`, expected: Token{TokenNumber, int64(255)}},
+		"Octal":              {input: `0o17`, expected: Token{TokenNumber, int64(15)}},
+		"Binary":             {input: `0b1010`, expected: Token{TokenNumber, int64(10)}},
+		"Leading Zero":       {input: `0755`, expected: Token{TokenNumber, int64(755)}},
+		"Bad Hex Is Atom":    {input: `0xZZ`, expected: Token{TokenAtom, "0xZZ"}},
+		"Underscore Is Atom": {input: `0x_FF`, expected: Token{TokenAtom, "0x_FF"}},
+		"Decimal":            {input: `1.2`, expected: Token{TokenNumber, 1.2}},
+		"Version Is Atom":    {input: `1.2.3`, expected: Token{TokenAtom, "1.2.3"}},
+		"Long Version":       {input: `1.2.3.4`, expected: Token{TokenAtom, "1.2.3.4"}},
+		"IP Address Is Atom": {input: `10.0.0.1`, expected: Token{TokenAtom, "10.0.0.1"}},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			lexer, err := NewLexer(WithReader(strings.NewReader(test.input)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tok, err := lexer.scan()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(*tok, test.expected) {
+				t.Fatalf("scanning %q yielded %#v; expected %#v", test.input, *tok, test.expected)
+			}
+		})
+	}
+}
+
+func TestRawNumbers(t *testing.T) {
+	lexer, err := NewLexer(WithReader(strings.NewReader("0x1F 1.0 500ms")), WithRawNumbers(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []Token{}
+	for tok := range lexer.Lex() {
+		got = append(got, tok)
+	}
+
+	// numbers keep their text but are still told apart from atoms.
+	expected := []Token{
+		{TokenNumber, "0x1F"}, {TokenWhiteSpace, " "},
+		{TokenNumber, "1.0"}, {TokenWhiteSpace, " "},
+		{TokenAtom, "500ms"}, {TokenEOF, nil},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("lexing yielded %v; expected %v", got, expected)
+	}
+
+	if v, ok := ParseNumber("0x1F"); !ok || v != int64(31) {
+		t.Fatalf("ParseNumber(\"0x1F\") returned %v, %v; expected 31, true", v, ok)
+	}
+}
+
+func TestBufferSize(t *testing.T) {
+	long := strings.Repeat("x", 256*1024)
+	input := "key=" + long + " n=1\n"
+
+	// a reader that isn't an io.RuneScanner, so it is read through a buffer.
+	reader := func() io.Reader { return struct{ io.Reader }{strings.NewReader(input)} }
+
+	tests := map[string][]func(*Lexer) error{
+		"Before Reader": {WithBufferSize(64 * 1024), WithReader(reader())},
+		"After Reader":  {WithReader(reader()), WithBufferSize(64 * 1024)},
+	}
+
+	for name, opts := range tests {
+		opts := opts
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			lexer, err := NewLexer(opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			toks, err := lexer.Tokens()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected := []Token{
+				{TokenAtom, "key"}, {TokenEqual, "="}, {TokenAtom, long}, {TokenWhiteSpace, " "},
+				{TokenAtom, "n"}, {TokenEqual, "="}, {TokenNumber, int64(1)}, {TokenNewLine, "\n"},
+			}
+			if !reflect.DeepEqual(toks, expected) {
+				t.Fatalf("lexing a %d byte line yielded %d tokens that differ from those expected", len(input), len(toks))
+			}
+		})
+	}
+
+	if _, err := NewLexer(WithBufferSize(0)); err == nil {
+		t.Fatal("a buffer size of zero was accepted")
+	}
+}
+
+func TestTruncatedUTF8(t *testing.T) {
+	tests := map[string]struct {
+		input     string
+		expected  []Token
+		shouldErr bool
+	}{
+		// "\xe2" is the first of the three bytes of '€'.
+		"Value":   {input: "a=\xe2", expected: []Token{{TokenAtom, "a"}, {TokenEqual, "="}, {TokenError, ErrTruncatedUTF8}}, shouldErr: true},
+		"Lexeme":  {input: "a=1 b=x\xe2\x82", expected: []Token{{TokenAtom, "a"}, {TokenEqual, "="}, {TokenNumber, int64(1)}, {TokenWhiteSpace, " "}, {TokenAtom, "b"}, {TokenEqual, "="}, {TokenError, ErrTruncatedUTF8}}, shouldErr: true},
+		"Quoted":  {input: "a=\"x\xe2", expected: []Token{{TokenAtom, "a"}, {TokenEqual, "="}, {TokenError, ErrTruncatedUTF8}}, shouldErr: true},
+		"Whole":   {input: "a=\xe2\x82\xac\n", expected: []Token{{TokenAtom, "a"}, {TokenEqual, "="}, {TokenAtom, "€"}, {TokenNewLine, "\n"}}},
+		"Invalid": {input: "a=\xe2\x82A b=\xff\n", expected: []Token{{TokenAtom, "a"}, {TokenEqual, "="}, {TokenAtom, "\uFFFD\uFFFDA"}, {TokenWhiteSpace, " "}, {TokenAtom, "b"}, {TokenEqual, "="}, {TokenAtom, "\uFFFD"}, {TokenNewLine, "\n"}}},
+	}
+
+	readers := map[string]func(string) io.Reader{
+		// a reader that hands over a byte at a time, as a network read might,
+		// and so is read through a bufio.Reader.
+		"OneByte":     func(s string) io.Reader { return iotest.OneByteReader(strings.NewReader(s)) },
+		"RuneScanner": func(s string) io.Reader { return strings.NewReader(s) },
+	}
+
+	for name, test := range tests {
+		for rname, reader := range readers {
+			test, reader := test, reader
+			t.Run(name+"/"+rname, func(t *testing.T) {
+				t.Parallel()
+
+				lexer, err := NewLexer(WithReader(reader(test.input)))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				toks, err := lexer.Tokens()
+				if test.shouldErr != (err != nil) {
+					t.Fatalf(".Tokens() returned error %v; expected an error: %v", err, test.shouldErr)
+				}
+				if test.shouldErr && !errors.Is(err, ErrTruncatedUTF8) {
+					t.Fatalf(".Tokens() returned error %v; expected %v", err, ErrTruncatedUTF8)
+				}
+
+				if !reflect.DeepEqual(toks, test.expected) {
+					t.Fatalf(".Tokens() yielded %v; expected %v", toks, test.expected)
+				}
+			})
+		}
+	}
+}
+
+func TestInterner(t *testing.T) {
+	sb := &strings.Builder{}
+	for i := 0; i < internLimit+10; i++ {
+		fmt.Fprintf(sb, "k%d=v%d\n", i, i)
+	}
+
+	lexer, err := NewLexer(WithReader(strings.NewReader(sb.String())), WithInterner(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lexer.Tokens(); err != nil {
+		t.Fatal(err)
+	}
+
+	// values that never repeat mustn't grow the table without bound.
+	if n := len(lexer.interned); n != internLimit {
+		t.Fatalf("interner holds %d lexemes; expected %d", n, internLimit)
+	}
+}
+
+// failingReader reads data and then fails with err.
+type failingReader struct {
+	data io.Reader
+	err  error
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	n, err := f.data.Read(p)
+	if err == io.EOF {
+		err = f.err
+	}
+	return n, err
+}
+
+func TestErr(t *testing.T) {
+	errDisk := errors.New("disk on fire")
+
+	tests := map[string]struct {
+		input    io.Reader
+		expected error
+	}{
+		"EOF":                {input: strings.NewReader("a=1\nb=2\n"), expected: nil},
+		"Unterminated Quote": {input: strings.NewReader("a=\"x\nb=2\n"), expected: nil},
+		"Read Error":         {input: &failingReader{data: strings.NewReader("a=1\n"), err: errDisk}, expected: errDisk},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			lexer, err := NewLexer(WithReader(test.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for range lexer.Lex() {
+			}
+			if err := lexer.Err(); err != test.expected {
+				t.Fatalf(".Err() returned %v; expected %v", err, test.expected)
+			}
+		})
+	}
+
+	t.Run("Canceled", func(t *testing.T) {
+		t.Parallel()
+
+		lexer, err := NewLexer(WithReader(strings.NewReader(strings.Repeat("a=1\n", 100))))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		tokens := lexer.LexContext(ctx)
+		<-tokens
+		cancel()
+		for range tokens {
+		}
+		if err := lexer.Err(); err != context.Canceled {
+			t.Fatalf(".Err() returned %v; expected %v", err, context.Canceled)
+		}
+	})
+}
+
+func TestQuoteRunes(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		expected []Token
+		err      error
+	}{
+		"Brackets": {
+			input:    "a=[x y] b=1",
+			expected: []Token{{TokenAtom, "a"}, {TokenEqual, "="}, {TokenQuotedString, "x y"}, {TokenWhiteSpace, " "}, {TokenAtom, "b"}, {TokenEqual, "="}, {TokenNumber, int64(1)}},
+		},
+		"Key": {
+			input:    "[my key]=1",
+			expected: []Token{{TokenQuotedString, "my key"}, {TokenEqual, "="}, {TokenNumber, int64(1)}},
+		},
+		"Open Inside": {
+			input:    "a=[x [y] z]",
+			expected: []Token{{TokenAtom, "a"}, {TokenEqual, "="}, {TokenQuotedString, "x [y"}, {TokenWhiteSpace, " "}, {TokenAtom, "z]"}},
+		},
+		"Escaped Close": {
+			input:    `a=[x\]y]`,
+			expected: []Token{{TokenAtom, "a"}, {TokenEqual, "="}, {TokenQuotedString, "x]y"}},
+		},
+		"Typographic": {
+			input:    "msg=\u201chello there\u201d",
+			expected: []Token{{TokenAtom, "msg"}, {TokenEqual, "="}, {TokenQuotedString, "hello there"}},
+		},
+		"Usual Quotes Kept": {
+			input:    `a="x]" b='[y'`,
+			expected: []Token{{TokenAtom, "a"}, {TokenEqual, "="}, {TokenQuotedString, "x]"}, {TokenWhiteSpace, " "}, {TokenAtom, "b"}, {TokenEqual, "="}, {TokenQuotedString, "[y"}},
+		},
+		"Unterminated": {
+			input:    "a=[x]]\nb=[y\n",
+			expected: []Token{{TokenAtom, "a"}, {TokenEqual, "="}, {TokenQuotedString, "x"}, {TokenAtom, "]"}, {TokenNewLine, "\n"}, {TokenAtom, "b"}, {TokenEqual, "="}, {TokenError, &UnterminatedQuoteError{Quote: '[', Offset: 9}}, {TokenNewLine, "\n"}},
+			err:      &UnterminatedQuoteError{Quote: '[', Offset: 9},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			lexer, err := NewLexer(WithReader(strings.NewReader(test.input)), WithQuoteRunes('[', ']'), WithQuoteRunes('\u201c', '\u201d'))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := lexer.Tokens()
+			if !reflect.DeepEqual(err, test.err) {
+				t.Fatalf(".Tokens() returned error %v; expected %v", err, test.err)
+			}
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf(".Tokens() yielded %v; expected %v", got, test.expected)
+			}
+		})
+	}
+
+	for _, pair := range [][2]rune{{'"', ']'}, {' ', ']'}, {'[', '='}, {'[', '\n'}, {'\\', ']'}} {
+		if _, err := NewLexer(WithQuoteRunes(pair[0], pair[1])); err == nil {
+			t.Fatalf("WithQuoteRunes(%q, %q) was accepted", pair[0], pair[1])
+		}
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	tests := map[string]struct {
+		pipe func() (io.ReadCloser, io.WriteCloser)
+	}{
+		// an io.Pipe can't take a deadline so it is read from a goroutine.
+		"Goroutine": {pipe: func() (io.ReadCloser, io.WriteCloser) { return io.Pipe() }},
+		"Deadline":  {pipe: func() (io.ReadCloser, io.WriteCloser) { return net.Pipe() }},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r, w := test.pipe()
+			defer r.Close()
+			defer w.Close()
+
+			// write one line and then stall.
+			go io.WriteString(w, "a=1\n")
+
+			lexer, err := NewLexer(WithReader(r), WithReadTimeout(20*time.Millisecond))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			done := make(chan struct{})
+			var toks []Token
+			go func() {
+				toks, err = lexer.Tokens()
+				close(done)
+			}()
+
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("the read timeout never fired")
+			}
+
+			if !errors.Is(err, ErrReadTimeout) {
+				t.Fatalf(".Tokens() returned error %v; expected %v", err, ErrReadTimeout)
+			}
+
+			got := []TokenType{}
+			for _, tok := range toks {
+				got = append(got, tok.Type)
+			}
+			if expected := []TokenType{TokenAtom, TokenEqual, TokenNumber, TokenNewLine, TokenError}; !reflect.DeepEqual(got, expected) {
+				t.Fatalf(".Tokens() yielded %v; expected %v", got, expected)
+			}
+		})
+	}
+
+	t.Run("Negative", func(t *testing.T) {
+		t.Parallel()
+
+		if _, err := NewLexer(WithReadTimeout(-time.Second)); err == nil {
+			t.Fatal("a negative read timeout was accepted")
+		}
+	})
+}
+
+// runeCounter is an io.RuneScanner that counts the runes read from it one at a
+// time.
+type runeCounter struct {
+	*strings.Reader
+	runes int
+}
+
+func (r *runeCounter) ReadRune() (rune, int, error) {
+	r.runes++
+	return r.Reader.ReadRune()
+}
+
+func TestForceBuffering(t *testing.T) {
+	tests := map[string]struct {
+		force bool
+		read  bool
+	}{
+		"Default": {read: true},
+		"Forced":  {force: true},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			rc := &runeCounter{Reader: strings.NewReader("a=1 b=two\n")}
+			lexer, err := NewLexer(WithReader(rc), WithForceBuffering(test.force))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			toks, err := lexer.Tokens()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(toks) != 8 {
+				t.Fatalf("lexing yielded %v; expected 8 tokens", toks)
+			}
+
+			if read := rc.runes > 0; read != test.read {
+				t.Fatalf("%d runes were read one at a time from the reader; expected any: %v", rc.runes, test.read)
+			}
+		})
+	}
+}
+
+func TestMaxTokenLength(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		limit    int
+		expected []Token
+	}{
+		"Too Long": {
+			input:    strings.Repeat("a", 4096),
+			limit:    8,
+			expected: []Token{{TokenError, ErrTokenTooLong}},
+		},
+		"Within Limit": {
+			input:    "key=value",
+			limit:    8,
+			expected: []Token{{TokenAtom, "key"}, {TokenEqual, "="}, {TokenAtom, "value"}, {TokenEOF, nil}},
+		},
+		"Unlimited": {
+			input:    strings.Repeat("a", 4096),
+			expected: []Token{{TokenAtom, strings.Repeat("a", 4096)}, {TokenEOF, nil}},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			lexer, err := NewLexer(WithReader(strings.NewReader(test.input)), WithMaxTokenLength(test.limit))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := []Token{}
+			for tok := range lexer.Lex() {
+				got = append(got, tok)
+			}
+
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("lexing yielded %v; expected %v", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestPeekN(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		n        int
+		expected string
+		err      error
+	}{
+		"Prefix":      {input: "=>value", n: 2, expected: "=>"},
+		"Whole Input": {input: "abc", n: 3, expected: "abc"},
+		"Short Input": {input: "ab", n: 5, expected: "ab", err: io.EOF},
+		"Empty Input": {input: "", n: 2, expected: "", err: io.EOF},
+		"Multi Byte":  {input: "héllo", n: 2, expected: "hé"},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			lexer, err := NewLexer(WithReader(strings.NewReader(test.input)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			runes, err := lexer.peekN(test.n)
+			if err != test.err {
+				t.Fatalf("peekN(%d) returned error %v; expected %v", test.n, err, test.err)
+			}
+			if got := string(runes); got != test.expected {
+				t.Fatalf("peekN(%d) yielded %q; expected %q", test.n, got, test.expected)
+			}
+
+			// the stream must be exactly as it was before peeking.
+			rest := &strings.Builder{}
+			for {
+				r, _, err := lexer.rs.ReadRune()
+				if err != nil {
+					break
+				}
+				rest.WriteRune(r)
+			}
+			if got := rest.String(); got != test.input {
+				t.Fatalf("after peeking the stream held %q; expected %q", got, test.input)
+			}
+		})
+	}
+}
+
+func TestComments(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		prefix   string
+		expected []Token
+	}{
+		"Whole Line": {
+			input:    "# a comment\na=b",
+			prefix:   "#",
+			expected: []Token{{TokenComment, "# a comment"}, {TokenNewLine, "\n"}, {TokenAtom, "a"}, {TokenEqual, "="}, {TokenAtom, "b"}, {TokenEOF, nil}},
+		},
+		"Inline": {
+			input:    "a=b // trailing\n",
+			prefix:   "//",
+			expected: []Token{{TokenAtom, "a"}, {TokenEqual, "="}, {TokenAtom, "b"}, {TokenWhiteSpace, " "}, {TokenComment, "// trailing"}, {TokenNewLine, "\n"}, {TokenEOF, nil}},
+		},
+		"End Of File": {
+			input:    "a=b #",
+			prefix:   "#",
+			expected: []Token{{TokenAtom, "a"}, {TokenEqual, "="}, {TokenAtom, "b"}, {TokenWhiteSpace, " "}, {TokenComment, "#"}, {TokenEOF, nil}},
+		},
+		"Disabled": {
+			input:    "#a",
+			expected: []Token{{TokenAtom, "#a"}, {TokenEOF, nil}},
+		},
+		"Partial Prefix": {
+			input:    "/a",
+			prefix:   "//",
+			expected: []Token{{TokenAtom, "/a"}, {TokenEOF, nil}},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			lexer, err := NewLexer(WithReader(strings.NewReader(test.input)), WithCommentPrefix(test.prefix))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := []Token{}
+			for tok := range lexer.Lex() {
+				got = append(got, tok)
+			}
+
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("lexing %q yielded %v; expected %v", test.input, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	t.Run("Unterminated Quote", func(t *testing.T) {
+		lexer, err := NewLexer(WithReader(strings.NewReader(`"oops`)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, s, err := lexer.ScanQuotedString()
+
+		var quoteErr *UnterminatedQuoteError
+		if !errors.As(err, &quoteErr) {
+			t.Fatalf(".ScanQuotedString() returned %v; expected an *UnterminatedQuoteError", err)
+		}
+		if quoteErr.Quote != '"' || quoteErr.Offset != 0 {
+			t.Fatalf(".ScanQuotedString() returned %#v; expected a '\"' at offset 0", quoteErr)
+		}
+		if s != "oops" {
+			t.Fatalf(".ScanQuotedString() yielded %q; expected %q", s, "oops")
+		}
+	})
+
+	t.Run("Class Mismatch", func(t *testing.T) {
+		lexer, err := NewLexer(WithReader(strings.NewReader(`ab=`)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// consume "ab" so the mismatching rune is not at the start.
+		if _, _, err := lexer.ScanAtom(); err != nil {
+			t.Fatal(err)
+		}
+
+		_, _, err = lexer.ScanWhiteSpace()
+		if !errors.Is(err, ErrClassMismatch) {
+			t.Fatalf(".ScanWhiteSpace() returned %v; expected ErrClassMismatch", err)
+		}
+
+		var runeErr *RuneError
+		if !errors.As(err, &runeErr) || runeErr.Rune != '=' || runeErr.Offset != 2 {
+			t.Fatalf(".ScanWhiteSpace() returned %#v; expected '=' at offset 2", err)
+		}
+
+		// a mismatch must leave the rune in the stream.
+		if _, s, _ := lexer.ScanEqual(); s != "=" {
+			t.Fatalf(".ScanEqual() yielded %q after a mismatch; expected %q", s, "=")
+		}
+	})
+}
+
+func TestUnterminatedQuotes(t *testing.T) {
+	tests := map[string]struct {
+		input     string
+		multiline bool
+		expected  []TokenType
+	}{
+		"At EOF":           {input: `a="oops`, expected: []TokenType{TokenAtom, TokenEqual, TokenError, TokenEOF}},
+		"At Newline":       {input: "a=\"oops\nb=1", expected: []TokenType{TokenAtom, TokenEqual, TokenError, TokenNewLine, TokenAtom, TokenEqual, TokenNumber, TokenEOF}},
+		"Spanning Newline": {input: "a=\"one\ntwo\"\n", multiline: true, expected: []TokenType{TokenAtom, TokenEqual, TokenQuotedString, TokenNewLine, TokenEOF}},
+		"Terminated":       {input: "a=\"fine\"\n", expected: []TokenType{TokenAtom, TokenEqual, TokenQuotedString, TokenNewLine, TokenEOF}},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			lexer, err := NewLexer(WithReader(strings.NewReader(test.input)), WithMultilineQuotes(test.multiline))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := []TokenType{}
+			for tok := range lexer.Lex() {
+				got = append(got, tok.Type)
+				if tok.Type == TokenError {
+					if _, ok := tok.Value.(*UnterminatedQuoteError); !ok {
+						t.Fatalf("error token holds %#v; expected an *UnterminatedQuoteError", tok.Value)
+					}
+				}
+			}
+
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("lexing %q yielded %v; expected %v", test.input, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestSeparator(t *testing.T) {
+	lexer, err := NewLexer(WithReader(strings.NewReader("a:b:c d=e")), WithSeparator(':'))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []Token{}
+	for tok := range lexer.Lex() {
+		got = append(got, tok)
+	}
+
+	expected := []Token{
+		{Type: TokenAtom, Value: "a"},
+		{Type: TokenEqual, Value: ":"},
+		{Type: TokenAtom, Value: "b:c"},
+		{Type: TokenWhiteSpace, Value: " "},
+		{Type: TokenAtom, Value: "d=e"},
+		{Type: TokenEOF},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("lexing yielded %v; expected %v", got, expected)
+	}
+
+	if _, err := NewLexer(WithSeparator(' ')); err == nil {
+		t.Fatal("white space was accepted as a separator")
+	}
+}
+
+func TestTabAsSeparator(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		tabs     bool
+		expected []Token
+	}{
+		"Spaces In Value": {
+			input:    "key=multi word value\tkey2=x",
+			tabs:     true,
+			expected: []Token{{TokenAtom, "key"}, {TokenEqual, "="}, {TokenAtom, "multi word value"}, {TokenWhiteSpace, "\t"}, {TokenAtom, "key2"}, {TokenEqual, "="}, {TokenAtom, "x"}},
+		},
+		"Spaces Between Pairs": {
+			input:    "a=b c\t d=1",
+			tabs:     true,
+			expected: []Token{{TokenAtom, "a"}, {TokenEqual, "="}, {TokenAtom, "b c"}, {TokenWhiteSpace, "\t "}, {TokenAtom, "d"}, {TokenEqual, "="}, {TokenNumber, int64(1)}},
+		},
+		"Spaces In Key": {
+			input:    "a b=c",
+			tabs:     true,
+			expected: []Token{{TokenAtom, "a"}, {TokenWhiteSpace, " "}, {TokenAtom, "b"}, {TokenEqual, "="}, {TokenAtom, "c"}},
+		},
+		"Carriage Return": {
+			input:    "a=b c\r\n",
+			tabs:     true,
+			expected: []Token{{TokenAtom, "a"}, {TokenEqual, "="}, {TokenAtom, "b c"}, {TokenWhiteSpace, "\r"}, {TokenNewLine, "\n"}},
+		},
+		"Off By Default": {
+			input:    "key=multi word",
+			expected: []Token{{TokenAtom, "key"}, {TokenEqual, "="}, {TokenAtom, "multi"}, {TokenWhiteSpace, " "}, {TokenAtom, "word"}},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			lexer, err := NewLexer(WithReader(strings.NewReader(test.input)), WithTabAsSeparator(test.tabs))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := lexer.Tokens()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("lexing %q yielded %q; expected %q", test.input, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestSpacedSeparator(t *testing.T) {
+	lexer, err := NewLexer(WithReader(strings.NewReader("a= x=1 b=2")), WithSpacedSeparator(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []Token{}
+	for tok := range lexer.Lex() {
+		got = append(got, tok)
+	}
+
+	// the value after the white space may hold a separator, but the white
+	// space after the value still ends it.
+	expected := []Token{
+		{Type: TokenAtom, Value: "a"},
+		{Type: TokenEqual, Value: "="},
+		{Type: TokenWhiteSpace, Value: " "},
+		{Type: TokenAtom, Value: "x=1"},
+		{Type: TokenWhiteSpace, Value: " "},
+		{Type: TokenAtom, Value: "b"},
+		{Type: TokenEqual, Value: "="},
+		{Type: TokenNumber, Value: int64(2)},
+		{Type: TokenEOF},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("lexing yielded %v; expected %v", got, expected)
+	}
+}
+
+func TestEOF(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		expected TokenType
+	}{
+		"Empty":            {input: ``, expected: TokenEOF},
+		"Trailing Atom":    {input: `a=b`, expected: TokenEOF},
+		"Trailing Newline": {input: "a=b\n", expected: TokenEOF},
+		"Error":            {input: `a=` + strings.Repeat("b", 32), expected: TokenError},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			lexer, err := NewLexer(WithReader(strings.NewReader(test.input)), WithMaxTokenLength(16))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := []TokenType{}
+			for tok := range lexer.Lex() {
+				got = append(got, tok.Type)
+			}
+
+			if n := len(got); n == 0 || got[n-1] != test.expected {
+				t.Fatalf("lexing %q yielded %v; expected it to end with %v", test.input, got, test.expected)
+			}
+		})
+	}
+}
+
+func BenchmarkScanAtom(b *testing.B) {
+	input := strings.Repeat("request_identifier=0123abcdef status_message=completed_successfully ", 256) + "\n"
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(input)))
+	for i := 0; i < b.N; i++ {
+		lexer, err := NewLexer(WithReader(strings.NewReader(input)))
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		for {
+			tok, err := lexer.scan()
+			if err != nil {
+				break
+			}
+			if tok.Type == TokenNewLine {
+				break
+			}
+		}
+	}
+}
+
+func BenchmarkBuffering(b *testing.B) {
+	input := []byte(strings.Repeat("request_identifier=0123abcdef status=200 took=1.5\n", 256))
+
+	for _, force := range []bool{false, true} {
+		name := "Unbuffered"
+		if force {
+			name = "Buffered"
+		}
+
+		force := force
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(input)))
+			for i := 0; i < b.N; i++ {
+				lexer, err := NewLexer(WithReader(bytes.NewReader(input)), WithForceBuffering(force))
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := lexer.Tokens(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestAtomEscapes(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		expected []Token
+	}{
+		"Escaped Separator":  {input: `a\=b`, expected: []Token{{TokenAtom, "a=b"}, {TokenEOF, nil}}},
+		"Escaped Space":      {input: `a\ b`, expected: []Token{{TokenAtom, "a b"}, {TokenEOF, nil}}},
+		"In Value":           {input: `filter=a\=b\ c`, expected: []Token{{TokenAtom, "filter"}, {TokenEqual, "="}, {TokenAtom, "a=b c"}, {TokenEOF, nil}}},
+		"Leading Escape":     {input: `\=a=1`, expected: []Token{{TokenAtom, "=a"}, {TokenEqual, "="}, {TokenNumber, int64(1)}, {TokenEOF, nil}}},
+		"Literal Backslash":  {input: `path=C:\logs\x`, expected: []Token{{TokenAtom, "path"}, {TokenEqual, "="}, {TokenAtom, `C:\logs\x`}, {TokenEOF, nil}}},
+		"Trailing Backslash": {input: `a\`, expected: []Token{{TokenAtom, `a\`}, {TokenEOF, nil}}},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			lexer, err := NewLexer(WithReader(strings.NewReader(test.input)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := []Token{}
+			for tok := range lexer.Lex() {
+				got = append(got, tok)
+			}
+
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("lexing %q yielded %v; expected %v", test.input, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestRawBackslash(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		expected []Token
+	}{
+		"Path":             {input: `path=C:\logs\app.log`, expected: []Token{{TokenAtom, "path"}, {TokenEqual, "="}, {TokenAtom, `C:\logs\app.log`}}},
+		"Before Space":     {input: `path=C:\dir\ n=1`, expected: []Token{{TokenAtom, "path"}, {TokenEqual, "="}, {TokenAtom, `C:\dir\`}, {TokenWhiteSpace, " "}, {TokenAtom, "n"}, {TokenEqual, "="}, {TokenNumber, int64(1)}}},
+		"Before Separator": {input: `a\=b`, expected: []Token{{TokenAtom, `a\`}, {TokenEqual, "="}, {TokenAtom, "b"}}},
+		"Quoted":           {input: `path="C:\dir\"`, expected: []Token{{TokenAtom, "path"}, {TokenEqual, "="}, {TokenQuotedString, `C:\dir\`}}},
+		"Quoted Escapes":   {input: `msg="a\tb"`, expected: []Token{{TokenAtom, "msg"}, {TokenEqual, "="}, {TokenQuotedString, `a\tb`}}},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			lexer, err := NewLexer(WithReader(strings.NewReader(test.input)), WithRawBackslash(true))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := lexer.Tokens()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("lexing %q yielded %v; expected %v", test.input, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestByteOrderMark(t *testing.T) {
+	lexer, err := NewLexer(WithReader(strings.NewReader("\uFEFFkey=\uFEFF")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []Token{}
+	for tok := range lexer.Lex() {
+		got = append(got, tok)
+	}
+
+	// only a mark at the very start of the input is dropped.  anywhere else it
+	// isn't printable so it is unidentified.
+	expected := []Token{{TokenAtom, "key"}, {TokenEqual, "="}, {TokenUnidentified, "\uFEFF"}, {TokenEOF, nil}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("lexing yielded %q; expected %q", got, expected)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	tests := map[string]struct {
+		input     string
+		expected  []TokenType
+		shouldErr bool
+	}{
+		"Quoted Value": {input: "a=\"b\"\n", expected: []TokenType{TokenAtom, TokenEqual, TokenQuotedString, TokenNewLine}},
+		"Empty":        {input: "", expected: []TokenType{}},
+		"Error":        {input: "a=\"b\nc=1", expected: []TokenType{TokenAtom, TokenEqual, TokenError, TokenNewLine, TokenAtom, TokenEqual, TokenNumber}, shouldErr: true},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			lexer, err := NewLexer(WithReader(strings.NewReader(test.input)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			toks, err := lexer.Tokens()
+			if test.shouldErr != (err != nil) {
+				t.Fatalf(".Tokens() returned error %v; expected an error: %v", err, test.shouldErr)
+			}
+
+			got := []TokenType{}
+			for _, tok := range toks {
+				got = append(got, tok.Type)
+			}
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf(".Tokens() yielded %v; expected %v", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestScanLine(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		expected [][]TokenType
+		errs     []error
+	}{
+		"Two Lines": {
+			input: "a=1\nb=c\n",
+			expected: [][]TokenType{
+				{TokenAtom, TokenEqual, TokenNumber, TokenNewLine},
+				{TokenAtom, TokenEqual, TokenAtom, TokenNewLine},
+				{TokenEOF},
+			},
+			errs: []error{nil, nil, io.EOF},
+		},
+		"No Trailing New Line": {
+			input: "a=1\nb=c",
+			expected: [][]TokenType{
+				{TokenAtom, TokenEqual, TokenNumber, TokenNewLine},
+				{TokenAtom, TokenEqual, TokenAtom, TokenEOF},
+			},
+			errs: []error{nil, io.EOF},
+		},
+		"White Space Only": {
+			input: "  \n",
+			expected: [][]TokenType{
+				{TokenWhiteSpace, TokenNewLine},
+				{TokenEOF},
+			},
+			errs: []error{nil, io.EOF},
+		},
+		"Unterminated Quote": {
+			input: "a=\"b\nc=1\n",
+			expected: [][]TokenType{
+				{TokenAtom, TokenEqual, TokenError, TokenNewLine},
+				{TokenAtom, TokenEqual, TokenNumber, TokenNewLine},
+				{TokenEOF},
+			},
+			errs: []error{&UnterminatedQuoteError{}, nil, io.EOF},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			lexer, err := NewLexer(WithReader(strings.NewReader(test.input)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, expected := range test.expected {
+				toks, err := lexer.ScanLine()
+				if reflect.TypeOf(err) != reflect.TypeOf(test.errs[i]) {
+					t.Fatalf("line %d: .ScanLine() returned error %v; expected %v", i, err, test.errs[i])
+				}
+
+				got := []TokenType{}
+				for _, tok := range toks {
+					got = append(got, tok.Type)
+				}
+				if !reflect.DeepEqual(got, expected) {
+					t.Fatalf("line %d: .ScanLine() yielded %v; expected %v", i, got, expected)
+				}
+			}
+		})
+	}
+}
+
+// lexOpenLine writes line to a pipe that is left open and returns the types of
+// the tokens lexed from it up to its newline.  it fails if the newline isn't
+// lexed, as when the lexer waits on input past it.
+func lexOpenLine(t *testing.T, line string, opts ...func(*Lexer) error) []TokenType {
+	t.Helper()
+
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go io.WriteString(pw, line)
+
+	lexer, err := NewLexer(append([]func(*Lexer) error{WithReader(pr)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	toks := lexer.Lex()
+
+	got := []TokenType{}
+	for {
+		select {
+		case tok := <-toks:
+			if got = append(got, tok.Type); tok.Type == TokenNewLine || tok.Type == TokenError {
+				return got
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("lexing %q stopped at %v while the input was still open", line, got)
+		}
+	}
+}
+
+func TestCommentLiveStream(t *testing.T) {
+	tests := map[string]struct {
+		prefix string
+	}{
+		"Single Rune": {prefix: "#"},
+		"Two Runes":   {prefix: "//"},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := lexOpenLine(t, "host=web msg=started\n", WithCommentPrefix(test.prefix))
+			expected := []TokenType{TokenAtom, TokenEqual, TokenAtom, TokenWhiteSpace, TokenAtom, TokenEqual, TokenAtom, TokenNewLine}
+			if !reflect.DeepEqual(got, expected) {
+				t.Fatalf("lexing with prefix %q yielded %v; expected %v", test.prefix, got, expected)
+			}
+		})
+	}
+}
+
+func TestSyslogPriority(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		syslog   bool
+		expected []Token
+	}{
+		"Priority": {
+			input:    "<134>1 a=b",
+			syslog:   true,
+			expected: []Token{{TokenPriority, int64(134)}, {TokenNumber, int64(1)}, {TokenWhiteSpace, " "}, {TokenAtom, "a"}, {TokenEqual, "="}, {TokenAtom, "b"}},
+		},
+		"Every Line": {
+			input:    "<0>a=1\n<191>b=2",
+			syslog:   true,
+			expected: []Token{{TokenPriority, int64(0)}, {TokenAtom, "a"}, {TokenEqual, "="}, {TokenNumber, int64(1)}, {TokenNewLine, "\n"}, {TokenPriority, int64(191)}, {TokenAtom, "b"}, {TokenEqual, "="}, {TokenNumber, int64(2)}},
+		},
+		"Not At Line Start": {
+			input:    "a=<134>",
+			syslog:   true,
+			expected: []Token{{TokenAtom, "a"}, {TokenEqual, "="}, {TokenAtom, "<134>"}},
+		},
+		"Too Large": {
+			input:    "<192>",
+			syslog:   true,
+			expected: []Token{{TokenAtom, "<192>"}},
+		},
+		"Empty":          {input: "<>", syslog: true, expected: []Token{{TokenAtom, "<>"}}},
+		"Too Long":       {input: "<1234>", syslog: true, expected: []Token{{TokenAtom, "<1234>"}}},
+		"Not Digits":     {input: "<ab>", syslog: true, expected: []Token{{TokenAtom, "<ab>"}}},
+		"Unterminated":   {input: "<13", syslog: true, expected: []Token{{TokenAtom, "<13"}}},
+		"Off By Default": {input: "<134>", expected: []Token{{TokenAtom, "<134>"}}},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			lexer, err := NewLexer(WithReader(strings.NewReader(test.input)), WithSyslogPriority(test.syslog))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := lexer.Tokens()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("lexing %q yielded %v; expected %v", test.input, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestSyslogPriorityLiveStream(t *testing.T) {
+	tests := map[string]struct {
+		line     string
+		expected []TokenType
+	}{
+		// no hex digits, which the uuid scanner of custom_test.go peeks past.
+		"Short Line": {line: "x=y\n", expected: []TokenType{TokenAtom, TokenEqual, TokenAtom, TokenNewLine}},
+		"Priority":   {line: "<1>\n", expected: []TokenType{TokenPriority, TokenNewLine}},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := lexOpenLine(t, test.line, WithSyslogPriority(true)); !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("lexing %q yielded %v; expected %v", test.line, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestWhiteSpaceTokens(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		expected []Token
+	}{
+		"Tab And Spaces":   {input: "a=1\t  b=2", expected: []Token{{TokenAtom, "a"}, {TokenEqual, "="}, {TokenNumber, int64(1)}, {TokenWhiteSpace, "\t  "}, {TokenAtom, "b"}, {TokenEqual, "="}, {TokenNumber, int64(2)}}},
+		"Leading":          {input: " \t a", expected: []Token{{TokenWhiteSpace, " \t "}, {TokenAtom, "a"}}},
+		"Carriage Return":  {input: "a \r\n", expected: []Token{{TokenAtom, "a"}, {TokenWhiteSpace, " \r"}, {TokenNewLine, "\n"}}},
+		"Around Newline":   {input: "\t\n\t", expected: []Token{{TokenWhiteSpace, "\t"}, {TokenNewLine, "\n"}, {TokenWhiteSpace, "\t"}}},
+		"Around Separator": {input: "key \t =  value", expected: []Token{{TokenAtom, "key"}, {TokenWhiteSpace, " \t "}, {TokenEqual, "="}, {TokenWhiteSpace, "  "}, {TokenAtom, "value"}}},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			lexer, err := NewLexer(WithReader(strings.NewReader(test.input)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := lexer.Tokens()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("lexing %q yielded %q; expected %q", test.input, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestTokenJSON(t *testing.T) {
+	tests := map[string]struct {
+		tok      Token
+		expected string
+	}{
+		"Atom":   {tok: Token{TokenAtom, "foo"}, expected: `{"type":"ATOM","value":"foo"}`},
+		"Number": {tok: Token{TokenNumber, int64(42)}, expected: `{"type":"NUMBER","value":42}`},
+		"Float":  {tok: Token{TokenNumber, 1.5}, expected: `{"type":"NUMBER","value":1.5}`},
+		"Error":  {tok: Token{TokenError, ErrTokenTooLong}, expected: `{"type":"ERROR","value":"` + ErrTokenTooLong.Error() + `"}`},
+		"EOF":    {tok: Token{Type: TokenEOF}, expected: `{"type":"EOF","value":null}`},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := json.Marshal(test.tok)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.expected {
+				t.Fatalf("marshaling %v yielded %s; expected %s", test.tok, got, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package lex
+
+import (
+	"errors"
+	"io"
+	"unicode/utf8"
+)
+
+var errNoUnread = errors.New("no rune to unread")
+
+type pending struct {
+	r    rune
+	size int
+}
+
+// pushback is an io.RuneScanner that can have any number of runes pushed back
+// onto it, where io.RuneScanner itself only promises to unread one.  it also
+// keeps track of how far into the input we are.
+type pushback struct {
+	rs io.RuneScanner
+
+	// pending holds pushed back runes with the next to be read last.
+	pending []pending
+
+	last      pending
+	canUnread bool
+
+	// offset is the number of bytes consumed.  lastOffset is the offset of the
+	// most recently read rune.
+	offset     int64
+	lastOffset int64
+
+	// err is ErrTruncatedUTF8 once the input has been found to end partway
+	// through a rune.
+	err error
+}
+
+func newPushback(rs io.RuneScanner) *pushback {
+	return &pushback{rs: rs}
+}
+
+func (p *pushback) ReadRune() (rune, int, error) {
+	var next pending
+	if n := len(p.pending); n > 0 {
+		next = p.pending[n-1]
+		p.pending = p.pending[:n-1]
+	} else {
+		r, size, err := p.read()
+		if err != nil {
+			p.canUnread = false
+			return r, size, err
+		}
+		next = pending{r: r, size: size}
+	}
+
+	p.last, p.canUnread = next, true
+	p.lastOffset = p.offset
+	p.offset += int64(next.size)
+	return next.r, next.size, nil
+}
+
+// read reads a rune from the underlying scanner.  a utf8.RuneError there is
+// either an invalid byte or the start of a multi-byte sequence cut short by
+// the end of the input, as happens when a stream is cut mid-rune.  the latter
+// is reported as ErrTruncatedUTF8 from then on.
+func (p *pushback) read() (rune, int, error) {
+	if p.err != nil {
+		return utf8.RuneError, 0, p.err
+	}
+	r, size, err := p.rs.ReadRune()
+	if err == nil && r == utf8.RuneError && size == 1 && p.truncated() {
+		p.err = ErrTruncatedUTF8
+		return utf8.RuneError, 0, p.err
+	}
+	return r, size, err
+}
+
+// truncated reports whether the byte just read as a utf8.RuneError begins a
+// sequence that the input ends before completing.  telling needs the bytes
+// themselves, so a scanner that isn't an io.ByteScanner is never truncated.
+//
+// the bytes read past the first are handed back as they would otherwise have
+// been read: each but the last, which a complete sequence ends on, is a rune
+// error of its own.
+func (p *pushback) truncated() bool {
+	bs, isByteScanner := p.rs.(io.ByteScanner)
+	if !isByteScanner || p.rs.UnreadRune() != nil {
+		return false
+	}
+
+	var seq [utf8.UTFMax]byte
+	n := 0
+	if b, err := bs.ReadByte(); err == nil {
+		seq[0], n = b, 1
+	}
+	if n == 0 || utf8.FullRune(seq[:n]) {
+		return false
+	}
+
+	for !utf8.FullRune(seq[:n]) {
+		b, err := bs.ReadByte()
+		if err == io.EOF {
+			return true
+		}
+		if err != nil {
+			break
+		}
+		seq[n] = b
+		n++
+	}
+
+	if utf8.FullRune(seq[:n]) && bs.UnreadByte() == nil {
+		n--
+	}
+	for i := 1; i < n; i++ {
+		p.pending = append(p.pending, pending{r: utf8.RuneError, size: 1})
+	}
+	return false
+}
+
+func (p *pushback) UnreadRune() error {
+	if !p.canUnread {
+		return errNoUnread
+	}
+	p.push(p.last.r, p.last.size)
+	return nil
+}
+
+// push places r, which took size bytes of input, back onto the stream so it
+// is the next rune read.
+func (p *pushback) push(r rune, size int) {
+	p.pending = append(p.pending, pending{r: r, size: size})
+	p.offset -= int64(size)
+	p.canUnread = false
+}
@@ -0,0 +1,61 @@
+package lex
+
+// maxPriority is the highest syslog priority: facility 23, severity 7.
+const maxPriority = 23*8 + 7
+
+// WithSyslogPriority lexes the <PRI> that starts a syslog line, such as the
+// <134> of <134>1 2003-10-11T22:14:15.003Z ..., as a TokenPriority.  a '<'
+// anywhere else, or one that doesn't start a priority of one to three digits
+// no greater than 191, is lexed as usual.
+func WithSyslogPriority(syslog bool) func(*Lexer) error {
+	return func(l *Lexer) error {
+		l.syslogPriority = syslog
+		return nil
+	}
+}
+
+// atPriority reports whether the input, which continues with r, continues with
+// a syslog priority.  the runes after the '<' are peeked at one at a time, so a
+// short line isn't held up waiting for runes of the next.
+func (l *Lexer) atPriority(r rune) bool {
+	if r != '<' {
+		return false
+	}
+
+	// '<', up to three digits and '>'.
+	pri := 0
+	for n := 2; n <= 5; n++ {
+		runes, _ := l.peekN(n)
+		if len(runes) < n {
+			return false
+		}
+		switch r := runes[n-1]; {
+		case r == '>':
+			return n > 2 && pri <= maxPriority
+		case digit(r) && n < 5:
+			pri = pri*10 + int(r-'0')
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// ScanPriority scans a syslog priority such as <134>.  the value is its
+// digits, without the angle brackets.
+func (l *Lexer) ScanPriority() (TokenType, string, error) {
+	return l.matchToken(TokenPriority, l.rs, func(r rune) (bool, bool, error) {
+		switch {
+		case !l.started:
+			if r != '<' {
+				return false, false, l.mismatch(r, "a syslog priority")
+			}
+			return false, true, nil
+		case r == '>':
+			return false, false, nil
+		case digit(r):
+			return true, true, nil
+		}
+		return false, false, l.mismatch(r, "a syslog priority")
+	})
+}
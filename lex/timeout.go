@@ -0,0 +1,111 @@
+package lex
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// ErrReadTimeout is held by the TokenError that ends lexing when a read takes
+// longer than the timeout given to WithReadTimeout.
+var ErrReadTimeout = errors.New("read timed out")
+
+// WithReadTimeout ends lexing with a TokenError holding ErrReadTimeout when a
+// single read of the input takes longer than d, so a stalled producer can't
+// hang the consumer.  a reader with a SetReadDeadline method, such as a
+// net.Conn, is given a deadline before each read.  any other reader is read
+// from a goroutine, which is left blocked in the read if the timeout fires.
+// the default of zero means reads may block forever.
+func WithReadTimeout(d time.Duration) func(*Lexer) error {
+	return func(l *Lexer) error {
+		if d < 0 {
+			return fmt.Errorf("read timeout must not be negative; got %v", d)
+		}
+		l.readTimeout = d
+
+		// the reader may have been given first.
+		if l.r != nil {
+			l.setReader(l.r)
+		}
+		return nil
+	}
+}
+
+type deadliner interface {
+	SetReadDeadline(time.Time) error
+}
+
+type readResult struct {
+	b   []byte
+	err error
+}
+
+// timeoutReader is an io.Reader whose reads fail with ErrReadTimeout once
+// they take longer than d.
+type timeoutReader struct {
+	r io.Reader
+	d time.Duration
+
+	// result delivers the read in flight on a goroutine, if there is one.
+	// rest holds what it read that didn't fit in the caller's buffer.
+	result chan readResult
+	rest   []byte
+	err    error
+}
+
+func newTimeoutReader(r io.Reader, d time.Duration) *timeoutReader {
+	return &timeoutReader{r: r, d: d}
+}
+
+func (t *timeoutReader) Read(p []byte) (int, error) {
+	if len(t.rest) > 0 || t.err != nil {
+		n := copy(p, t.rest)
+		t.rest = t.rest[n:]
+		if len(t.rest) > 0 {
+			return n, nil
+		}
+		err := t.err
+		t.err = nil
+		return n, err
+	}
+
+	// a read that timed out on a goroutine may still be in flight.
+	if dl, ok := t.r.(deadliner); ok && t.result == nil {
+		if err := dl.SetReadDeadline(time.Now().Add(t.d)); err == nil {
+			n, err := t.r.Read(p)
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				err = ErrReadTimeout
+			}
+			return n, err
+		}
+		// some readers, such as regular files, don't support deadlines.
+	}
+
+	if t.result == nil {
+		t.result = make(chan readResult, 1)
+		b := make([]byte, len(p))
+		go func() {
+			n, err := t.r.Read(b)
+			t.result <- readResult{b: b[:n], err: err}
+		}()
+	}
+
+	timer := time.NewTimer(t.d)
+	defer timer.Stop()
+
+	select {
+	case res := <-t.result:
+		t.result = nil
+		n := copy(p, res.b)
+		t.rest = res.b[n:]
+		if len(t.rest) > 0 {
+			t.err = res.err
+			return n, nil
+		}
+		return n, res.err
+	case <-timer.C:
+		return 0, ErrReadTimeout
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// listen accepts the streams sent to addr, which is tcp://host:port or
+// udp://host:port, and passes each one to handle along with the address of
+// its sender.  it only returns if the listener fails.
+func listen(addr string, handle func(r io.Reader, peer string)) error {
+	i := strings.Index(addr, "://")
+	if i < 0 {
+		return fmt.Errorf("-listen must be tcp://host:port or udp://host:port; got %q", addr)
+	}
+
+	switch network, host := addr[:i], addr[i+3:]; network {
+	case "tcp":
+		ln, err := net.Listen(network, host)
+		if err != nil {
+			return err
+		}
+		defer ln.Close()
+		return serveStream(ln, handle)
+	case "udp":
+		pc, err := net.ListenPacket(network, host)
+		if err != nil {
+			return err
+		}
+		defer pc.Close()
+		return servePackets(pc, handle)
+	default:
+		return fmt.Errorf("-listen supports tcp and udp; got %q", network)
+	}
+}
+
+// serveStream handles each connection accepted by ln on its own goroutine, so
+// every connection is parsed by a parser of its own and a line that arrives
+// in pieces can't be mixed up with another connection's.
+func serveStream(ln net.Listener, handle func(r io.Reader, peer string)) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			defer conn.Close()
+			handle(conn, conn.RemoteAddr().String())
+		}()
+	}
+}
+
+// servePackets handles each datagram received by pc as a complete input,
+// which may hold several lines.  handle gets a copy so it may hold on to it.
+func servePackets(pc net.PacketConn, handle func(r io.Reader, peer string)) error {
+	buf := make([]byte, 64*1024)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		handle(bytes.NewReader(append([]byte(nil), buf[:n]...)), addr.String())
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io"
+	"net"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ayang64/ginsu/parse"
+)
+
+func TestServeStream(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	got := []map[string]interface{}{}
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- serveStream(ln, func(r io.Reader, peer string) {
+			defer wg.Done()
+
+			p, err := parse.NewParser(parse.WithReader(r))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			p.ParseFunc(func(m map[string]interface{}) error {
+				mu.Lock()
+				defer mu.Unlock()
+				got = append(got, m)
+				return nil
+			})
+		})
+	}()
+
+	dial := func() net.Conn {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+
+	// the first connection's line arrives in two pieces with another
+	// connection's line in between; each connection has its own parser so
+	// they don't mix.
+	first, second := dial(), dial()
+	io.WriteString(first, "a=1 b=")
+	io.WriteString(second, "c=3\n")
+	second.Close()
+	time.Sleep(10 * time.Millisecond)
+	io.WriteString(first, "2\n")
+	first.Close()
+
+	wg.Wait()
+	ln.Close()
+	if err := <-served; err == nil {
+		t.Fatal("serving returned no error once the listener was closed")
+	}
+
+	sort.Slice(got, func(i, j int) bool { return len(got[i]) > len(got[j]) })
+	expected := []map[string]interface{}{{"a": int64(1), "b": int64(2)}, {"c": int64(3)}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("the connections yielded %#v; expected %#v", got, expected)
+	}
+}
+
+func TestListenRejects(t *testing.T) {
+	tests := map[string][]string{
+		"Files":   {"-listen", "tcp://127.0.0.1:0", "app.log"},
+		"Workers": {"-listen", "tcp://127.0.0.1:0", "-workers", "2"},
+		"Tail":    {"-listen", "tcp://127.0.0.1:0", "-tail", "1"},
+		"Array":   {"-listen", "tcp://127.0.0.1:0", "-json-array"},
+		"Scheme":  {"-listen", "unix:///tmp/ginsu.sock"},
+		"Address": {"-listen", ":5514"},
+	}
+
+	for name, args := range tests {
+		args := args
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if code, _, _ := runWith(t, "", args...); code == 0 {
+				t.Fatalf("run accepted %q", args)
+			}
+		})
+	}
+}
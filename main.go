@@ -1,32 +1,155 @@
 package main
 
 import (
+	"bytes"
 	"flag"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"runtime/pprof"
 	"runtime/trace"
+	"sort"
+	"sync"
 	"text/template"
+	"time"
 
+	"github.com/ayang64/ginsu/encode"
+	"github.com/ayang64/ginsu/lex"
 	"github.com/ayang64/ginsu/parse"
 )
 
 func main() {
-	expr := flag.String("t", "{{.}}", "template to parse for each log line")
-	file := flag.String("f", "/dev/stdin", "path of file to parse")
-	verbose := flag.Bool("v", false, "verbose output")
-	output := flag.String("o", "/dev/stdout", "path to send output")
-	cpuprofile := flag.String("cpuprofile", "", "path to cpu profile")
-	memprofile := flag.String("memprofile", "", "path to memory profile")
-	tracefile := flag.String("trace", "", "path to trace file")
-	flag.Parse()
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run is the body of the command.  it is separate from main() so it can be
+// exercised by tests with its own arguments and streams.  the returned value is
+// the process exit code: 0 once every line was parsed and rendered cleanly, 1
+// if the input couldn't be read, and otherwise exitRenderError or
+// exitParseError.
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("ginsu", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	expr := flags.String("t", "{{.}}", "template to parse for each log line")
+	tmplFile := flags.String("tf", "", "path of a file containing the template; excludes -t")
+	tmplSwitch := flags.String("tmpl-switch", "", "render each record with the -case template matching its value of this key, or else with -t or -tf")
+	var cases templateCases
+	flags.Var(&cases, "case", "value=templatefile: render records whose -tmpl-switch key holds value with the template in templatefile; may be repeated")
+	file := flags.String("f", "-", "path of file to parse (- for stdin)")
+	verbose := flags.Bool("v", false, "verbose output: what became of malformed input")
+	veryVerbose := flags.Bool("vv", false, "more verbose output: -v and a trace of every token")
+	output := flags.String("o", "-", "path to send output (- for stdout)")
+	listenAddr := flags.String("listen", "", "parse the streams sent to tcp://host:port or udp://host:port instead of reading files")
+	follow := flags.Bool("follow", false, "keep reading the file as it grows, like tail -f")
+	informat := flags.String("informat", "logfmt", "format of the input: logfmt or json")
+	jsonOutput := flags.Bool("json", false, "emit each record as a line of json; -t is ignored")
+	jsonArray := flags.Bool("json-array", false, "emit every record as an element of a single json array; -t is ignored")
+	csvOutput := flags.Bool("csv", false, "emit records as csv with a header row; -t is ignored")
+	tsvOutput := flags.Bool("tsv", false, "emit records as tab separated values with a header row; -t is ignored")
+	withFilename := flags.Bool("with-filename", false, "add the name of the input file to each record under _file")
+	countKey := flags.String("count", "", "print how many records had each value of this key instead of rendering them")
+	fieldList := flags.String("fields", "", "comma separated list of keys to keep in each record; json and table output list them in this order")
+	sortKeys := flags.Bool("sort-keys", false, "list the -fields keys in sorted order rather than as given; without -fields, json and table output already sort keys and templates can range over sortedKeys")
+	workers := flags.Int("workers", 1, "number of lines to parse and render concurrently; output order is preserved")
+	split := flags.String("split", "", "rune that ends each record instead of a newline (nul for \\0)")
+	showStats := flags.Bool("stats", false, "print counts of lines, records and errors to stderr when done")
+	showProgress := flags.Bool("progress", false, "print how much input has been read to stderr every second")
+	dump := flags.Bool("dump-tokens", false, "print the tokens the lexer finds instead of parsing them; -json prints them as json")
+	validateOnly := flags.Bool("validate", false, "only check that every line parses to a non-empty record; problems go to stderr")
+	head := flags.Int("head", 0, "only render the first n records that pass the filters")
+	tail := flags.Int("tail", 0, "only render the last n records that pass the filters")
+	rate := flags.Float64("rate", 0, "render about this many records a second, for demos")
+	replayKey := flags.String("replay-realtime", "", "render records as far apart in time as their timestamps under this key")
+	var where conditions
+	flags.Var(&where, "where", "only emit records where key op value, op being one of = != > >= < <=; may be repeated")
+	cpuprofile := flags.String("cpuprofile", "", "path to cpu profile")
+	memprofile := flags.String("memprofile", "", "path to memory profile")
+	tracefile := flags.String("trace", "", "path to trace file")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	explicit := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	fail := func(format string, args ...interface{}) int {
+		fmt.Fprintf(stderr, format+"\n", args...)
+		return 1
+	}
+
+	if explicit["t"] && explicit["tf"] {
+		return fail("-t and -tf cannot be used together")
+	}
+
+	if (*tmplSwitch != "") != (len(cases) > 0) {
+		return fail("-tmpl-switch and -case must be used together")
+	}
+
+	if *tmplSwitch != "" && countTrue(*jsonOutput, *jsonArray, *csvOutput, *tsvOutput, *countKey != "") > 0 {
+		return fail("-tmpl-switch only chooses between templates")
+	}
+
+	if formats := countTrue(*jsonOutput, *jsonArray, *csvOutput, *tsvOutput, *countKey != ""); formats > 1 {
+		return fail("only one of -json, -json-array, -csv, -tsv and -count may be given")
+	}
+
+	if *head < 0 || *tail < 0 {
+		return fail("-head and -tail must not be negative")
+	}
+
+	if *head > 0 && *tail > 0 {
+		return fail("-head and -tail cannot be used together")
+	}
+
+	if *rate < 0 {
+		return fail("-rate must not be negative")
+	}
+
+	if *rate > 0 && *replayKey != "" {
+		return fail("-rate and -replay-realtime cannot be used together")
+	}
+
+	if *workers < 1 {
+		return fail("-workers must be at least 1")
+	}
+
+	delimiter, err := parseDelimiter(*split)
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	if *workers > 1 && delimiter != '\n' {
+		return fail("-workers cannot be used with -split")
+	}
+
+	if *informat != "logfmt" && *informat != "json" {
+		return fail("unknown input format %q", *informat)
+	}
+
+	if *listenAddr != "" {
+		if len(flags.Args()) > 0 || explicit["f"] {
+			return fail("-listen cannot be used with files to read")
+		}
+		// these need the input to end, which a listener's doesn't.
+		for _, name := range []string{"follow", "validate", "workers", "head", "tail", "count", "json-array"} {
+			if explicit[name] {
+				return fail("-listen cannot be used with -%s", name)
+			}
+		}
+	}
+
+	if *dump && *informat != "logfmt" {
+		return fail("-dump-tokens only lexes logfmt input")
+	}
 
 	if *memprofile != "" {
 		outf, err := os.Create(*memprofile)
 		if err != nil {
-			log.Fatal(err)
+			return fail("%v", err)
 		}
 		defer outf.Close()
 
@@ -36,7 +159,7 @@ func main() {
 	if *tracefile != "" {
 		outf, err := os.Create(*tracefile)
 		if err != nil {
-			log.Fatal(err)
+			return fail("%v", err)
 		}
 		defer outf.Close()
 
@@ -47,7 +170,7 @@ func main() {
 	if *cpuprofile != "" {
 		outf, err := os.Create(*cpuprofile)
 		if err != nil {
-			log.Fatal(err)
+			return fail("%v", err)
 		}
 		defer outf.Close()
 
@@ -55,42 +178,432 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 
-	inf, err := os.Open(*file)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer inf.Close()
-
-	outf, err := os.OpenFile(*output, os.O_CREATE, 0644)
-	if err != nil {
-		log.Fatal(err)
+	// records go to out; diagnostics only ever go to stderr so they can't
+	// corrupt the data stream.
+	out := stdout
+	if *output != "-" {
+		outf, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return fail("%v", err)
+		}
+		defer outf.Close()
+		out = outf
 	}
-	defer outf.Close()
 
 	logWriter := func() io.Writer {
-		if *verbose {
-			return os.Stdout
+		if *verbose || *veryVerbose {
+			return stderr
 		}
 		return ioutil.Discard
 	}
 
 	l := log.New(logWriter(), "PARSE: ", log.LstdFlags)
+	level := lex.LevelInfo
+	if *veryVerbose {
+		level = lex.LevelDebug
+	}
 
-	p, err := parse.NewParser(parse.WithReader(inf), parse.WithLogger(l))
-	if err != nil {
-		log.Fatal(err)
+	fields := parseFields(*fieldList)
+	if *sortKeys {
+		sort.Strings(fields)
 	}
 
-	tmpl, err := template.New("x").Parse(*expr)
-	if err != nil {
-		log.Fatalf("could not parse template %q: %v", *expr, err)
+	// stats totals the counts of every parser that was run.  -listen runs
+	// parsers concurrently, so it is only added to under statsMu.
+	var stats parse.Stats
+	var statsMu sync.Mutex
+	addStats := func(s parse.Stats) {
+		statsMu.Lock()
+		defer statsMu.Unlock()
+		stats.Add(s)
+	}
+
+	var render func(map[string]interface{}) error
+	flush := func() error { return nil }
+
+	// renderTo is set when records can be rendered independently of each other
+	// into any writer, which lets -workers render them concurrently.
+	var renderTo func(io.Writer, map[string]interface{}) error
+
+	var enc encode.Encoder
+	switch {
+	case *countKey != "":
+		t := newTally(*countKey)
+		render, flush = t.add, func() error { return t.write(out) }
+	case *jsonOutput:
+		enc = encode.NewJSON(fields)
+	case *jsonArray:
+		enc = encode.NewJSONArray(out, fields)
+	case *csvOutput, *tsvOutput:
+		comma := ','
+		if *tsvOutput {
+			comma = '\t'
+		}
+		enc = encode.NewCSV(comma, fields)
+	default:
+		tmpl, err := template.New("x").Funcs(parse.FuncMap()).Parse(*expr)
+		if err != nil {
+			return fail("could not parse template %q: %v", *expr, err)
+		}
+
+		if *tmplFile != "" {
+			tmpl, err = template.New(filepath.Base(*tmplFile)).Funcs(parse.FuncMap()).ParseFiles(*tmplFile)
+			if err != nil {
+				return fail("could not parse template file: %v", err)
+			}
+		}
+		enc = encode.NewTemplate(tmpl)
+
+		if *tmplSwitch != "" {
+			encs, err := cases.encoders()
+			if err != nil {
+				return fail("%v", err)
+			}
+			enc = encode.NewSwitch(*tmplSwitch, encs, enc)
+		}
+	}
+
+	switch enc.(type) {
+	case nil:
+	case *encode.CSV, *encode.JSONArray:
+		// rows share a header, and elements their separators, so they are
+		// written in one place.
+		render = func(m map[string]interface{}) error { return enc.Encode(out, m) }
+		flush = enc.Flush
+
+		// a followed file or a listener doesn't end, so rows can't wait
+		// for the flush after the input.
+		if _, isCSV := enc.(*encode.CSV); isCSV && (*follow || *listenAddr != "") {
+			render = func(m map[string]interface{}) error {
+				if err := enc.Encode(out, m); err != nil {
+					return err
+				}
+				return enc.Flush()
+			}
+		}
+	default:
+		renderTo, flush = enc.Encode, enc.Flush
+	}
+
+	// renderErrors counts the records that couldn't be rendered, such as when
+	// a template fails on them.  the first error is reported and rendering
+	// carries on with the next record.
+	renderErrors := 0
+	var renderMu sync.Mutex
+	renderFailed := func(err error) {
+		renderMu.Lock()
+		defer renderMu.Unlock()
+		if renderErrors == 0 {
+			fmt.Fprintf(stderr, "could not render a record: %v\n", err)
+		}
+		renderErrors++
+	}
+
+	if to := renderTo; to != nil {
+		render = func(m map[string]interface{}) error { return to(out, m) }
+		renderTo = func(w io.Writer, m map[string]interface{}) error {
+			if err := to(w, m); err != nil {
+				renderFailed(err)
+			}
+			return nil
+		}
 	}
 
-	for m := range p.Parse() {
-		if len(m) == 0 {
-			continue
+	unchecked := render
+	render = func(m map[string]interface{}) error {
+		if err := unchecked(m); err != nil {
+			renderFailed(err)
+		}
+		return nil
+	}
+
+	// records are paced in the order they are rendered, so with -workers they
+	// are handed back to be rendered in one place.
+	var pace *pacer
+	switch {
+	case *rate > 0:
+		pace = newRatePacer(*rate, time.Now, time.Sleep)
+	case *replayKey != "":
+		pace = newReplayPacer(*replayKey, time.Now, time.Sleep)
+	}
+	if pace != nil {
+		next := render
+		render = func(m map[string]interface{}) error {
+			pace.wait(m)
+			return next(m)
 		}
-		tmpl.Execute(os.Stdout, m)
+		renderTo = nil
 	}
 
+	// -head and -tail count every record rendered, so with -workers records
+	// are handed back to be rendered in one place rather than by the workers.
+	switch {
+	case *head > 0:
+		n, next := 0, render
+		render = func(m map[string]interface{}) error {
+			next(m)
+			if n++; n >= *head {
+				return errHeadReached
+			}
+			return nil
+		}
+		renderTo = nil
+	case *tail > 0:
+		last := newRing(*tail)
+		next, done := render, flush
+		render = last.add
+		flush = func() error {
+			last.each(func(m map[string]interface{}) error {
+				next(m)
+				return nil
+			})
+			return done()
+		}
+		renderTo = nil
+	}
+
+	// prog counts the input as it is read for -progress.  reports go to
+	// stderr so they stay out of the data.
+	var prog *progress
+	if *showProgress {
+		prog = newProgress(delimiter, time.Now)
+		stop := prog.start(stderr, time.Second)
+		defer stop()
+	}
+
+	// newParser returns a parser for r, which was read from path.
+	newParser := func(r io.Reader, path string, opts ...func(*parse.Parser) error) (*parse.Parser, error) {
+		opts = append([]func(*parse.Parser) error{parse.WithReader(r), parse.WithLogger(l), parse.WithLogLevel(level), parse.WithJSONInput(*informat == "json"), parse.WithRecordDelimiter(delimiter)}, opts...)
+		if *withFilename {
+			opts = append(opts, parse.WithSource(path), parse.WithSourceKey("_file"))
+		}
+		return parse.NewParser(opts...)
+	}
+
+	// invalid counts the lines that failed -validate across every input.
+	invalid := 0
+
+	// accept filters and decorates a parsed record; it reports false for
+	// records that shouldn't be rendered.
+	accept := func(m map[string]interface{}) (map[string]interface{}, bool) {
+		if len(m) == 0 || !where.match(m) {
+			return nil, false
+		}
+		if len(fields) > 0 {
+			m = project(m, fields)
+		}
+		return m, true
+	}
+
+	// parseLine is the work done for each line with -workers.  records are
+	// rendered right away when the output allows it and handed back otherwise.
+	parseLine := func(line []byte, path string) lineResult {
+		p, err := newParser(bytes.NewReader(line), path)
+		if err != nil {
+			return lineResult{err: err}
+		}
+
+		var res lineResult
+		buf := &bytes.Buffer{}
+		p.ParseFunc(func(m map[string]interface{}) error {
+			m, ok := accept(m)
+			switch {
+			case !ok:
+			case renderTo != nil:
+				renderTo(buf, m)
+			default:
+				res.records = append(res.records, m)
+			}
+			return nil
+		})
+		res.rendered = buf.Bytes()
+		res.stats = p.Stats()
+		return res
+	}
+
+	// parseStream reads a single input, rendering each record it yields.
+	// every input gets its own parser so a truncated last line can't bleed
+	// into the next one.
+	parseStream := func(inf io.Reader, path string) error {
+		if prog != nil {
+			inf = prog.countBytes(inf)
+		}
+		inf, err := parse.Decompress(inf)
+		if err != nil {
+			return fmt.Errorf("could not read %q: %v", path, err)
+		}
+		if prog != nil {
+			inf = prog.countLines(inf)
+		}
+
+		if *dump {
+			return dumpTokens(out, inf, *jsonOutput, lex.WithRecordDelimiter(delimiter))
+		}
+
+		if *validateOnly {
+			v := newValidator(path, stderr)
+			p, err := newParser(inf, path, parse.WithErrorHandler(v.error))
+			if err != nil {
+				return err
+			}
+			err = p.ParseFunc(v.record)
+			addStats(p.Stats())
+			invalid += v.invalid()
+			return err
+		}
+
+		if *workers > 1 {
+			return parallel(inf, *workers, func(line []byte) lineResult {
+				return parseLine(line, path)
+			}, func(res lineResult) error {
+				if _, err := out.Write(res.rendered); err != nil {
+					return err
+				}
+				addStats(res.stats)
+				for _, m := range res.records {
+					if err := render(m); err == errHeadReached {
+						return err
+					}
+				}
+				return nil
+			})
+		}
+
+		p, err := newParser(inf, path)
+		if err != nil {
+			return err
+		}
+
+		// rendering errors don't stop the input being read unless -head has
+		// been reached.
+		err = p.ParseFunc(func(m map[string]interface{}) error {
+			if m, ok := accept(m); ok {
+				if err := render(m); err == errHeadReached {
+					return err
+				}
+			}
+			return nil
+		})
+		addStats(p.Stats())
+		return err
+	}
+
+	// parseInput reads the file at path, or stdin for "-".
+	parseInput := func(path string) error {
+		inf := stdin
+		if path != "-" {
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			inf = f
+		}
+		if prog != nil {
+			prog.addInput(inf)
+		}
+
+		if *follow {
+			inf = newFollower(inf, 250*time.Millisecond, nil)
+		}
+		return parseStream(inf, path)
+	}
+
+	if *listenAddr != "" {
+		// connections are parsed concurrently, but their records are
+		// rendered one at a time.
+		var mu sync.Mutex
+		next := render
+		render = func(m map[string]interface{}) error {
+			mu.Lock()
+			defer mu.Unlock()
+			return next(m)
+		}
+
+		err := listen(*listenAddr, func(r io.Reader, peer string) {
+			if err := parseStream(r, peer); err != nil {
+				fmt.Fprintf(stderr, "%s: %v\n", peer, err)
+			}
+		})
+		return fail("%v", err)
+	}
+
+	// positional arguments name further files to parse after -f.  when there
+	// are some, -f is only read if it was given explicitly.
+	paths := flags.Args()
+	if len(paths) == 0 || explicit["f"] {
+		paths = append([]string{*file}, paths...)
+	}
+
+	for _, path := range paths {
+		err := parseInput(path)
+		if err == errHeadReached {
+			break
+		}
+		if err != nil {
+			return fail("%v", err)
+		}
+	}
+
+	if err := flush(); err != nil {
+		return fail("%v", err)
+	}
+
+	if invalid > 0 {
+		return fail("lines failing validation: %d", invalid)
+	}
+
+	if *showStats {
+		fmt.Fprintf(stderr, "lines=%d records=%d empty=%d skipped=%d errors=%d\n", stats.Lines, stats.Records, stats.Empty, stats.Skipped, stats.Errors)
+	}
+
+	switch {
+	case stats.Errors > 0:
+		fmt.Fprintf(stderr, "errors while parsing: %d; -v shows them\n", stats.Errors)
+		return exitParseError
+	case renderErrors > 0:
+		fmt.Fprintf(stderr, "records that could not be rendered: %d\n", renderErrors)
+		return exitRenderError
+	}
+	return 0
+}
+
+// the exit codes of run() other than 0 for success and 1 for failing to read
+// the input or being asked to do something that can't be done.
+const (
+	exitRenderError = 2 // a record could not be rendered, such as by its template
+	exitParseError  = 3 // a line of input had an error; takes precedence over 2
+)
+
+func countTrue(bs ...bool) int {
+	n := 0
+	for _, b := range bs {
+		if b {
+			n++
+		}
+	}
+	return n
+}
+
+// parseDelimiter interprets the -split flag.  it is either empty for the
+// default of a newline, "nul", or a single rune.
+func parseDelimiter(s string) (rune, error) {
+	switch s {
+	case "":
+		return '\n', nil
+	case "nul":
+		return 0, nil
+	}
+
+	r := []rune(s)
+	if len(r) != 1 {
+		return 0, fmt.Errorf("-split must be a single rune or nul; got %q", s)
+	}
+
+	// the lexer needs these to separate keys from values and to quote them.
+	switch r[0] {
+	case '=', '"', '\'', '`':
+		return 0, fmt.Errorf("-split cannot be %q", r[0])
+	}
+	return r[0], nil
 }
@@ -0,0 +1,717 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runWith invokes run() with the supplied arguments and standard input and
+// returns its exit code along with everything written to stdout and stderr.
+func runWith(t *testing.T, input string, args ...string) (int, string, string) {
+	t.Helper()
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := run(args, strings.NewReader(input), stdout, stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestJSONOutput(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		args     []string
+		expected string
+	}{
+		"Single Line":        {input: "a=1 b=two\n", args: []string{"-json"}, expected: `{"a":1,"b":"two"}` + "\n"},
+		"Template Ignored":   {input: "a=1 b=two\n", args: []string{"-json", "-t", "{{.a}}"}, expected: `{"a":1,"b":"two"}` + "\n"},
+		"Empty Maps Skipped": {input: "\n\na=1\n\n", args: []string{"-json"}, expected: `{"a":1}` + "\n"},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			code, got, stderr := runWith(t, test.input, test.args...)
+			if code != 0 {
+				t.Fatalf("run() exited with %d: %s", code, stderr)
+			}
+
+			if got != test.expected {
+				t.Fatalf("run(%q) wrote %q; expected %q", test.args, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestJSONArray(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		args     []string
+		expected []map[string]interface{}
+	}{
+		"Empty Input": {input: "", expected: []map[string]interface{}{}},
+		"No Records":  {input: "\n\n", expected: []map[string]interface{}{}},
+		"Records":     {input: "a=1\nb=two\n", expected: []map[string]interface{}{{"a": 1.0}, {"b": "two"}}},
+		"Workers":     {input: "a=1\nb=2\nc=3\n", args: []string{"-workers", "2"}, expected: []map[string]interface{}{{"a": 1.0}, {"b": 2.0}, {"c": 3.0}}},
+		"Tail":        {input: "a=1\nb=2\nc=3\n", args: []string{"-tail", "2"}, expected: []map[string]interface{}{{"b": 2.0}, {"c": 3.0}}},
+		"Fields":      {input: "a=1 b=2\n", args: []string{"-fields", "b"}, expected: []map[string]interface{}{{"b": 2.0}}},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			code, got, stderr := runWith(t, test.input, append([]string{"-json-array"}, test.args...)...)
+			if code != 0 {
+				t.Fatalf("run() exited with %d: %s", code, stderr)
+			}
+
+			var records []map[string]interface{}
+			if err := json.Unmarshal([]byte(got), &records); err != nil {
+				t.Fatalf("run(%q) wrote %q, which isn't a json array: %v", test.args, got, err)
+			}
+			if !reflect.DeepEqual(records, test.expected) {
+				t.Fatalf("run(%q) wrote %q; expected the records %v", test.args, got, test.expected)
+			}
+		})
+	}
+
+	if code, _, _ := runWith(t, "a=1\n", "-json-array", "-json"); code != 1 {
+		t.Fatalf("-json-array with -json exited with %d; expected 1", code)
+	}
+}
+
+func TestTemplateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "record.tmpl")
+	body := `{{define "field"}}<{{.}}>{{end}}{{template "field" .a}} {{template "field" .b}}` + "\n"
+	if err := ioutil.WriteFile(path, []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	code, got, stderr := runWith(t, "a=1 b=2\na=3 b=4\n", "-tf", path)
+	if code != 0 {
+		t.Fatalf("run() exited with %d: %s", code, stderr)
+	}
+
+	if expected := "<1> <2>\n<3> <4>\n"; got != expected {
+		t.Fatalf("rendering with %q wrote %q; expected %q", path, got, expected)
+	}
+}
+
+func TestTemplateFileExcludesTemplate(t *testing.T) {
+	code, _, stderr := runWith(t, "a=1\n", "-t", "{{.a}}", "-tf", "x.tmpl")
+	if code == 0 {
+		t.Fatal("run() succeeded with both -t and -tf")
+	}
+
+	if !strings.Contains(stderr, "-t and -tf") {
+		t.Fatalf("stderr %q does not explain the conflict", stderr)
+	}
+}
+
+func TestTemplateSwitch(t *testing.T) {
+	dir := t.TempDir()
+	templates := map[string]string{
+		"error.tmpl": "ERROR {{.msg}}\n",
+		"warn.tmpl":  "WARN {{.msg}}\n",
+	}
+	for name, body := range templates {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	input := "level=error msg=a\nlevel=info msg=b\nlevel=warn msg=c\nmsg=d\n"
+	code, got, stderr := runWith(t, input,
+		"-tmpl-switch", "level",
+		"-case", "error="+filepath.Join(dir, "error.tmpl"),
+		"-case", "warn="+filepath.Join(dir, "warn.tmpl"),
+		"-t", "{{.level}}: {{.msg}}\n")
+	if code != 0 {
+		t.Fatalf("run() exited with %d: %s", code, stderr)
+	}
+
+	if expected := "ERROR a\ninfo: b\nWARN c\n<no value>: d\n"; got != expected {
+		t.Fatalf("switching templates on level wrote %q; expected %q", got, expected)
+	}
+
+	if code, _, _ := runWith(t, input, "-tmpl-switch", "level"); code != 1 {
+		t.Fatalf("-tmpl-switch without -case exited with %d; expected 1", code)
+	}
+
+	if code, _, _ := runWith(t, input, "-case", "error=x.tmpl"); code != 1 {
+		t.Fatalf("-case without -tmpl-switch exited with %d; expected 1", code)
+	}
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	code, got, stderr := runWith(t, "level=info\n", "-t", "{{.level | upper}}\n")
+	if code != 0 {
+		t.Fatalf("run() exited with %d: %s", code, stderr)
+	}
+
+	if expected := "INFO\n"; got != expected {
+		t.Fatalf("run() wrote %q; expected %q", got, expected)
+	}
+}
+
+func TestTemplatePointer(t *testing.T) {
+	code, got, stderr := runWith(t, "a=1\nb=2\n", "-t", "[{{ptr \"/a\" .}}]\n")
+	if code != 0 {
+		t.Fatalf("run() exited with %d: %s", code, stderr)
+	}
+	if expected := "[1]\n[]\n"; got != expected {
+		t.Fatalf("run() wrote %q; expected %q", got, expected)
+	}
+}
+
+func TestWhere(t *testing.T) {
+	input := "status=200 path=/\nstatus=500 path=/a\nstatus=500 path=/b\n"
+
+	code, got, stderr := runWith(t, input, "-where", "status=500", "-where", "path!=/b", "-t", "{{.path}}\n")
+	if code != 0 {
+		t.Fatalf("run() exited with %d: %s", code, stderr)
+	}
+
+	if expected := "/a\n"; got != expected {
+		t.Fatalf("run() wrote %q; expected %q", got, expected)
+	}
+}
+
+func TestFields(t *testing.T) {
+	tests := map[string]struct {
+		args     []string
+		expected string
+	}{
+		"JSON":          {args: []string{"-fields", "a,c", "-json"}, expected: `{"a":1,"c":3}` + "\n"},
+		"JSON Order":    {args: []string{"-fields", "c,a", "-json"}, expected: `{"c":3,"a":1}` + "\n"},
+		"JSON Missing":  {args: []string{"-fields", "z,b", "-json"}, expected: `{"b":2}` + "\n"},
+		"CSV Order":     {args: []string{"-fields", "c,a", "-csv"}, expected: "c,a\n3,1\n"},
+		"Workers Order": {args: []string{"-fields", "c,a", "-json", "-workers", "2"}, expected: `{"c":3,"a":1}` + "\n"},
+		"Sort Keys":     {args: []string{"-fields", "c,a", "-json", "-sort-keys"}, expected: `{"a":1,"c":3}` + "\n"},
+		"Sort Columns":  {args: []string{"-fields", "c,b", "-csv", "-sort-keys"}, expected: "b,c\n2,3\n"},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			code, got, stderr := runWith(t, "a=1 b=2 c=3\n", test.args...)
+			if code != 0 {
+				t.Fatalf("run() exited with %d: %s", code, stderr)
+			}
+
+			if got != test.expected {
+				t.Fatalf("run() wrote %q; expected %q", got, test.expected)
+			}
+		})
+	}
+}
+
+// TestSortedKeysTemplate checks that templates can render every key in sorted
+// order, the keys of nested objects included.
+func TestSortedKeysTemplate(t *testing.T) {
+	const tmpl = "{{range sortedKeys .}}{{.}}={{index $ .}} {{end}}\n"
+
+	tests := map[string]struct {
+		input    string
+		args     []string
+		expected string
+	}{
+		"Logfmt": {input: "c=3 a=1 b=2\n", args: []string{"-t", tmpl}, expected: "a=1 b=2 c=3 \n"},
+		"Nested": {input: `{"z":{"y":1,"x":2},"a":{"b":3}}` + "\n", args: []string{"-informat", "json", "-t", tmpl}, expected: "a.b=3 z.x=2 z.y=1 \n"},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			code, got, stderr := runWith(t, test.input, test.args...)
+			if code != 0 {
+				t.Fatalf("run() exited with %d: %s", code, stderr)
+			}
+
+			if got != test.expected {
+				t.Fatalf("run() wrote %q; expected %q", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestCSV(t *testing.T) {
+	input := "a=1 b=\"x, y\"\nb=2 c=3\n"
+
+	code, got, stderr := runWith(t, input, "-csv", "-fields", "a,b,c")
+	if code != 0 {
+		t.Fatalf("run() exited with %d: %s", code, stderr)
+	}
+
+	if expected := "a,b,c\n1,\"x, y\",\n,2,3\n"; got != expected {
+		t.Fatalf("run() wrote %q; expected %q", got, expected)
+	}
+}
+
+func TestMultipleFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	first, second := filepath.Join(dir, "app.log.1"), filepath.Join(dir, "app.log")
+	if err := ioutil.WriteFile(first, []byte("n=1\nn=2 truncated="), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(second, []byte("n=3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	code, got, stderr := runWith(t, "", "-with-filename", "-t", "{{._file}} {{.n}}\n", first, second)
+	if code != 0 {
+		t.Fatalf("run() exited with %d: %s", code, stderr)
+	}
+
+	// the truncated last line of the rotated file ends with that file.
+	expected := first + " 1\n" + first + " 2\n" + second + " 3\n"
+	if got != expected {
+		t.Fatalf("run() wrote %q; expected %q", got, expected)
+	}
+}
+
+func TestVerboseLogsStayOutOfData(t *testing.T) {
+	tests := map[string]struct {
+		flag  string
+		trace bool
+	}{
+		"Info":  {flag: "-v"},
+		"Debug": {flag: "-vv", trace: true},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			code, stdout, stderr := runWith(t, "bare a=1\n", test.flag, "-json")
+			if code != 0 {
+				t.Fatalf("run() exited with %d: %s", code, stderr)
+			}
+
+			if expected := `{"a":1}` + "\n"; stdout != expected {
+				t.Fatalf("run() wrote %q to stdout; expected only %q", stdout, expected)
+			}
+
+			if !strings.Contains(stderr, `PARSE: `) || !strings.Contains(stderr, `key "bare" has no value`) {
+				t.Fatalf("run() wrote %q to stderr; expected verbose log lines", stderr)
+			}
+			if traced := strings.Contains(stderr, "PEEKED AT"); traced != test.trace {
+				t.Fatalf("run() wrote %q to stderr; expected a token trace: %v", stderr, test.trace)
+			}
+		})
+	}
+}
+
+func TestOutputFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.json")
+
+	code, stdout, stderr := runWith(t, "a=1\n", "-json", "-o", path)
+	if code != 0 {
+		t.Fatalf("run() exited with %d: %s", code, stderr)
+	}
+
+	if stdout != "" {
+		t.Fatalf("run() wrote %q to stdout; expected nothing", stdout)
+	}
+
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"a":1}` + "\n"; string(got) != expected {
+		t.Fatalf("run() wrote %q to %s; expected %q", got, path, expected)
+	}
+}
+
+func TestCount(t *testing.T) {
+	input := "status=200\nstatus=500\nstatus=200\nmsg=none\nstatus=404\nstatus=200\n"
+
+	code, got, stderr := runWith(t, input, "-count", "status")
+	if code != 0 {
+		t.Fatalf("run() exited with %d: %s", code, stderr)
+	}
+
+	if expected := "200\t3\n404\t1\n500\t1\n<none>\t1\n"; got != expected {
+		t.Fatalf("run() wrote %q; expected %q", got, expected)
+	}
+}
+
+func TestJSONInput(t *testing.T) {
+	code, got, stderr := runWith(t, `{"req":{"method":"GET"},"status":500}`+"\n", "-informat", "json", "-where", "status=500", "-t", "{{index . \"req.method\"}}\n")
+	if code != 0 {
+		t.Fatalf("run() exited with %d: %s", code, stderr)
+	}
+
+	if expected := "GET\n"; got != expected {
+		t.Fatalf("run() wrote %q; expected %q", got, expected)
+	}
+}
+
+func TestWorkers(t *testing.T) {
+	sb := &strings.Builder{}
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(sb, "n=%d level=%s msg=\"line %d\"\n", i, []string{"info", "warn", "error"}[i%3], i)
+		if i%7 == 0 {
+			sb.WriteString("\n")
+		}
+	}
+	input := sb.String()
+
+	tests := map[string][]string{
+		"Template": {"-t", "{{.n}} {{.msg}}\n"},
+		"JSON":     {"-json"},
+		"CSV":      {"-csv", "-fields", "n,level"},
+		"Count":    {"-count", "level"},
+		"Where":    {"-json", "-where", "level=warn"},
+	}
+
+	for name, args := range tests {
+		args := args
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			code, expected, stderr := runWith(t, input, args...)
+			if code != 0 {
+				t.Fatalf("sequential run exited with %d: %s", code, stderr)
+			}
+
+			code, got, stderr := runWith(t, input, append([]string{"-workers", "8"}, args...)...)
+			if code != 0 {
+				t.Fatalf("parallel run exited with %d: %s", code, stderr)
+			}
+
+			if got != expected {
+				t.Fatalf("parallel output differs from sequential output:\n%s\nexpected:\n%s", got, expected)
+			}
+		})
+	}
+}
+
+func TestSplit(t *testing.T) {
+	code, got, stderr := runWith(t, "a=1\nb=2\x00a=3\x00", "-split", "nul", "-json")
+	if code != 0 {
+		t.Fatalf("run exited with %d: %s", code, stderr)
+	}
+
+	if expected := `{"a":1,"b":2}` + "\n" + `{"a":3}` + "\n"; got != expected {
+		t.Fatalf("run wrote %q; expected %q", got, expected)
+	}
+}
+
+func TestSplitRejected(t *testing.T) {
+	tests := map[string]string{
+		"Separator":    "=",
+		"Double Quote": `"`,
+		"Single Quote": "'",
+		"Two Runes":    "ab",
+	}
+
+	for name, split := range tests {
+		split := split
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			code, _, stderr := runWith(t, "a=1\n", "-split", split, "-json")
+			if code == 0 {
+				t.Fatalf("run accepted -split %q", split)
+			}
+			if !strings.Contains(stderr, "-split") {
+				t.Fatalf("run wrote %q to stderr; expected it to explain -split", stderr)
+			}
+		})
+	}
+}
+
+func TestStats(t *testing.T) {
+	const input = "a=1\n\nb=\"open\nc=3\n"
+	const expected = "lines=4 records=2 empty=1 skipped=1 errors=1\n"
+
+	for name, args := range map[string][]string{"Sequential": {"-stats"}, "Workers": {"-stats", "-workers", "4"}} {
+		args := args
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// the line with an error sets the exit code.
+			code, _, stderr := runWith(t, input, args...)
+			if code != exitParseError {
+				t.Fatalf("run exited with %d; expected %d: %s", code, exitParseError, stderr)
+			}
+			if !strings.HasPrefix(stderr, expected) {
+				t.Fatalf("run wrote %q to stderr; expected it to start with %q", stderr, expected)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		code     int
+		expected string
+	}{
+		"Clean":        {input: "a=1\nb=2\n", code: 0, expected: ""},
+		"Bad Line":     {input: "a=1\nb=\"oops\nc=3\n", code: 1, expected: "-:2: string quoted"},
+		"Empty Record": {input: "a=1\nb=\"oops\nbare\nc=3\n", code: 1, expected: "-:3: empty record"},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			code, stdout, stderr := runWith(t, test.input, "-validate")
+			if code != test.code {
+				t.Fatalf("run exited with %d; expected %d: %s", code, test.code, stderr)
+			}
+			if stdout != "" {
+				t.Fatalf("run wrote %q to stdout; expected nothing", stdout)
+			}
+			if !strings.Contains(stderr, test.expected) {
+				t.Fatalf("run wrote %q to stderr; expected it to contain %q", stderr, test.expected)
+			}
+		})
+	}
+}
+
+func TestHeadTail(t *testing.T) {
+	sb := &strings.Builder{}
+	for i := 1; i <= 10; i++ {
+		fmt.Fprintf(sb, "n=%d\n", i)
+	}
+	input := sb.String()
+
+	tests := map[string]struct {
+		args     []string
+		expected string
+	}{
+		"Head":         {args: []string{"-head", "3"}, expected: "1\n2\n3\n"},
+		"Tail":         {args: []string{"-tail", "3"}, expected: "8\n9\n10\n"},
+		"Head Workers": {args: []string{"-head", "3", "-workers", "4"}, expected: "1\n2\n3\n"},
+		"Tail Workers": {args: []string{"-tail", "3", "-workers", "4"}, expected: "8\n9\n10\n"},
+		"Short Tail":   {args: []string{"-tail", "20"}, expected: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			code, got, stderr := runWith(t, input, append(test.args, "-t", "{{.n}}\n")...)
+			if code != 0 {
+				t.Fatalf("run exited with %d: %s", code, stderr)
+			}
+			if got != test.expected {
+				t.Fatalf("run wrote %q; expected %q", got, test.expected)
+			}
+		})
+	}
+
+	t.Run("Both", func(t *testing.T) {
+		t.Parallel()
+
+		if code, _, _ := runWith(t, input, "-head", "3", "-tail", "3"); code == 0 {
+			t.Fatal("run accepted -head with -tail")
+		}
+	})
+}
+
+func TestRate(t *testing.T) {
+	code, got, stderr := runWith(t, "a=1\na=2\na=3\n", "-rate", "1000", "-workers", "2", "-t", "{{.a}}\n")
+	if code != 0 {
+		t.Fatalf("run() exited with %d: %s", code, stderr)
+	}
+	if expected := "1\n2\n3\n"; got != expected {
+		t.Fatalf("-rate wrote %q; expected %q", got, expected)
+	}
+
+	for _, args := range [][]string{{"-rate", "-1"}, {"-rate", "10", "-replay-realtime", "ts"}} {
+		if code, _, _ := runWith(t, "a=1\n", args...); code != 1 {
+			t.Fatalf("run() with %q exited with %d; expected 1", args, code)
+		}
+	}
+}
+
+func TestProgressOnStderr(t *testing.T) {
+	code, got, stderr := runWith(t, "a=1\na=2\n", "-progress", "-t", "{{.a}}\n")
+	if code != 0 {
+		t.Fatalf("run() exited with %d: %s", code, stderr)
+	}
+	if expected := "1\n2\n"; got != expected {
+		t.Fatalf("-progress wrote %q; expected %q", got, expected)
+	}
+	if !strings.HasPrefix(stderr, "progress: 2 lines, 8 bytes") {
+		t.Fatalf("-progress reported %q", stderr)
+	}
+}
+
+// TestHeadLiveStream checks that -head returns once it has its records even
+// though the input is still open.
+func TestHeadLiveStream(t *testing.T) {
+	tests := map[string]struct {
+		args []string
+	}{
+		"Serial":  {args: []string{"-head", "1", "-t", "{{.n}}\n"}},
+		"Workers": {args: []string{"-head", "1", "-workers", "2", "-t", "{{.n}}\n"}},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			pr, pw := io.Pipe()
+			defer pw.Close()
+			go pw.Write([]byte("n=1\nn=2\n"))
+
+			stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+			done := make(chan int, 1)
+			go func() { done <- run(test.args, pr, stdout, stderr) }()
+
+			select {
+			case code := <-done:
+				if code != 0 {
+					t.Fatalf("run exited with %d: %s", code, stderr)
+				}
+				if got := stdout.String(); got != "1\n" {
+					t.Fatalf("run wrote %q; expected %q", got, "1\n")
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("run didn't return with -head while the input was still open")
+			}
+		})
+	}
+}
+
+// TestFollowCSV checks that -follow writes csv rows as they come rather than
+// holding them for the end of an input that doesn't end.
+func TestFollowCSV(t *testing.T) {
+	inr, inw := io.Pipe()
+	defer inw.Close()
+	outr, outw := io.Pipe()
+	defer outr.Close()
+
+	go run([]string{"-follow", "-csv"}, inr, outw, ioutil.Discard)
+	go inw.Write([]byte("a=1\n"))
+
+	lines := make(chan string)
+	go func() {
+		br := bufio.NewReader(outr)
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				return
+			}
+			lines <- line
+		}
+	}()
+
+	for _, expected := range []string{"a\n", "1\n"} {
+		select {
+		case got := <-lines:
+			if got != expected {
+				t.Fatalf("-follow -csv wrote %q; expected %q", got, expected)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("-follow -csv didn't write %q while the input was still open", expected)
+		}
+	}
+}
+
+func TestDumpTokens(t *testing.T) {
+	const input = "a=1 msg=\"hi there\"\n"
+
+	tests := map[string]struct {
+		args     []string
+		expected string
+	}{
+		"Text": {
+			args:     []string{"-dump-tokens"},
+			expected: "ATOM\t\"a\"\nEQUAL\t\"=\"\nNUMBER\t1\nWHITE-SPACE\t\" \"\nATOM\t\"msg\"\nEQUAL\t\"=\"\nQUOTED-STRING\t\"hi there\"\nNEWLINE\t\"\\n\"\nEOF\n",
+		},
+		"JSON": {
+			args: []string{"-dump-tokens", "-json"},
+			expected: `{"type":"ATOM","value":"a"}` + "\n" + `{"type":"EQUAL","value":"="}` + "\n" + `{"type":"NUMBER","value":1}` + "\n" +
+				`{"type":"WHITE-SPACE","value":" "}` + "\n" + `{"type":"ATOM","value":"msg"}` + "\n" + `{"type":"EQUAL","value":"="}` + "\n" +
+				`{"type":"QUOTED-STRING","value":"hi there"}` + "\n" + `{"type":"NEWLINE","value":"\n"}` + "\n" + `{"type":"EOF","value":null}` + "\n",
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			code, got, stderr := runWith(t, input, test.args...)
+			if code != 0 {
+				t.Fatalf("run exited with %d: %s", code, stderr)
+			}
+			if got != test.expected {
+				t.Fatalf("run wrote %q; expected %q", got, test.expected)
+			}
+		})
+	}
+
+	t.Run("Files", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		in, out := filepath.Join(dir, "in.log"), filepath.Join(dir, "tokens")
+		if err := ioutil.WriteFile(in, []byte("k=v"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if code, _, stderr := runWith(t, "", "-dump-tokens", "-f", in, "-o", out); code != 0 {
+			t.Fatalf("run exited with %d: %s", code, stderr)
+		}
+
+		got, err := ioutil.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := "ATOM\t\"k\"\nEQUAL\t\"=\"\nATOM\t\"v\"\nEOF\n"; string(got) != expected {
+			t.Fatalf("run wrote %q; expected %q", got, expected)
+		}
+	})
+}
+
+func TestExitCode(t *testing.T) {
+	tests := map[string]struct {
+		input string
+		args  []string
+		code  int
+	}{
+		"Clean":          {input: "a=1\n", args: []string{"-t", "{{.a}}\n"}, code: 0},
+		"Template Error": {input: "a=1\nb=2\n", args: []string{"-t", "{{.a.b}}\n"}, code: exitRenderError},
+		"Workers":        {input: "a=1\nb=2\n", args: []string{"-t", "{{.a.b}}\n", "-workers", "2"}, code: exitRenderError},
+		"Parse Error":    {input: "a=\"open\nb=2\n", args: []string{"-t", "{{.b}}\n"}, code: exitParseError},
+		"Both":           {input: "a=\"open\nb=2\n", args: []string{"-t", "{{.b.c}}\n"}, code: exitParseError},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if code, _, stderr := runWith(t, test.input, test.args...); code != test.code {
+				t.Fatalf("run exited with %d; expected %d: %s", code, test.code, stderr)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import "time"
+
+// pacer holds records back before they are rendered, either to a steady rate
+// for -rate or as far apart as their timestamps for -replay-realtime.
+type pacer struct {
+	// interval is the time between records at a steady rate.  key names the
+	// timestamp replayed instead when it is set.
+	interval time.Duration
+	key      string
+
+	now   func() time.Time
+	sleep func(time.Duration)
+
+	// due is when the next record may be rendered at a steady rate.  last is
+	// the timestamp of the latest record to have one.
+	due  time.Time
+	last time.Time
+}
+
+// newRatePacer returns a pacer that lets through about rate records a second.
+func newRatePacer(rate float64, now func() time.Time, sleep func(time.Duration)) *pacer {
+	return &pacer{interval: time.Duration(float64(time.Second) / rate), now: now, sleep: sleep}
+}
+
+// newReplayPacer returns a pacer that waits between records for as long as
+// their timestamps under key are apart.
+func newReplayPacer(key string, now func() time.Time, sleep func(time.Duration)) *pacer {
+	return &pacer{key: key, now: now, sleep: sleep}
+}
+
+// wait blocks until rec may be rendered.
+func (p *pacer) wait(rec map[string]interface{}) {
+	if p.key != "" {
+		p.replay(rec)
+		return
+	}
+
+	// a record rendered late isn't made up for by rushing the next ones.
+	now := p.now()
+	if p.due.After(now) {
+		p.sleep(p.due.Sub(now))
+		now = p.due
+	}
+	p.due = now.Add(p.interval)
+}
+
+// replay waits for the time between the previous timestamp and rec's.  records
+// without a timestamp, or whose timestamp goes back in time, aren't held back.
+func (p *pacer) replay(rec map[string]interface{}) {
+	ts, ok := timestamp(rec[p.key])
+	if !ok {
+		return
+	}
+	if d := ts.Sub(p.last); !p.last.IsZero() && d > 0 {
+		p.sleep(d)
+	}
+	p.last = ts
+}
+
+// timestamp returns v as a time.  v is either one already, as WithTimeField
+// makes them, or a string holding an RFC 3339 time.
+func timestamp(v interface{}) (time.Time, bool) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
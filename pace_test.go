@@ -0,0 +1,82 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock that only moves when it is slept on or advanced.
+type fakeClock struct {
+	t      time.Time
+	sleeps []time.Duration
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func (c *fakeClock) sleep(d time.Duration) {
+	c.sleeps = append(c.sleeps, d)
+	c.t = c.t.Add(d)
+}
+
+func TestPacer(t *testing.T) {
+	start := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	tests := map[string]struct {
+		pacer    func(*fakeClock) *pacer
+		records  []map[string]interface{}
+		work     time.Duration
+		expected []time.Duration
+	}{
+		"Rate": {
+			pacer:    func(c *fakeClock) *pacer { return newRatePacer(4, c.now, c.sleep) },
+			records:  []map[string]interface{}{{}, {}, {}},
+			expected: []time.Duration{250 * time.Millisecond, 250 * time.Millisecond},
+		},
+		"Rate With Work": {
+			pacer:    func(c *fakeClock) *pacer { return newRatePacer(4, c.now, c.sleep) },
+			records:  []map[string]interface{}{{}, {}, {}},
+			work:     100 * time.Millisecond,
+			expected: []time.Duration{150 * time.Millisecond, 150 * time.Millisecond},
+		},
+		"Rate Behind": {
+			pacer:    func(c *fakeClock) *pacer { return newRatePacer(4, c.now, c.sleep) },
+			records:  []map[string]interface{}{{}, {}, {}},
+			work:     time.Second,
+			expected: nil,
+		},
+		"Replay": {
+			pacer: func(c *fakeClock) *pacer { return newReplayPacer("ts", c.now, c.sleep) },
+			records: []map[string]interface{}{
+				{"ts": "2021-03-04T05:06:07Z"},
+				{"ts": "2021-03-04T05:06:08.5Z"},
+				{"msg": "no timestamp"},
+				{"ts": "not a time"},
+				{"ts": start.Add(3 * time.Second)},
+				{"ts": "2021-03-04T05:06:00Z"},
+				{"ts": "2021-03-04T05:06:01Z"},
+			},
+			expected: []time.Duration{1500 * time.Millisecond, 1500 * time.Millisecond, time.Second},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			clock := &fakeClock{t: start}
+			p := test.pacer(clock)
+			for _, rec := range test.records {
+				p.wait(rec)
+				clock.t = clock.t.Add(test.work)
+			}
+
+			if !reflect.DeepEqual(clock.sleeps, test.expected) {
+				t.Fatalf("pacing slept for %v; expected %v", clock.sleeps, test.expected)
+			}
+		})
+	}
+}
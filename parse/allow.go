@@ -0,0 +1,121 @@
+package parse
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ayang64/ginsu/lex"
+)
+
+// DisallowedMode selects what the parser does with a pair whose key isn't one
+// of those given to WithAllowedKeys.
+type DisallowedMode int
+
+const (
+	// DisallowedDrop drops the pair.
+	DisallowedDrop = DisallowedMode(iota)
+	// DisallowedError drops the pair and reports an error naming its key.
+	DisallowedError
+)
+
+// WithAllowedKeys stores only the pairs whose key is one of keys, which keeps
+// input with an unbounded number of distinct keys from growing the records,
+// and whatever indexes them, without bound.  keys are matched as they would be
+// stored, after WithKeyTransform and as the full dotted key with
+// WithNestedKeys.  the pairs left out are counted in Stats.Dropped.  by
+// default every key is allowed.
+func WithAllowedKeys(keys ...string) func(*Parser) error {
+	return func(p *Parser) error {
+		p.allowedKeys = make(map[string]bool, len(keys))
+		for _, key := range keys {
+			p.allowedKeys[key] = true
+		}
+		return nil
+	}
+}
+
+// WithOnDisallowed sets how a pair whose key isn't allowed by WithAllowedKeys
+// is handled.  the default is DisallowedDrop.
+func WithOnDisallowed(mode DisallowedMode) func(*Parser) error {
+	return func(p *Parser) error {
+		switch mode {
+		case DisallowedDrop, DisallowedError:
+			p.onDisallowed = mode
+			return nil
+		}
+		return fmt.Errorf("unknown disallowed key mode %d", mode)
+	}
+}
+
+// allowed reports whether a pair with key may be stored, counting and
+// reporting it if not.
+func (p *Parser) allowed(key string) bool {
+	if p.allowedKeys == nil || p.allowedKeys[key] {
+		return true
+	}
+
+	p.stats.Dropped++
+	if p.onDisallowed == DisallowedError {
+		p.report(fmt.Errorf("key %q is not allowed", key))
+	}
+	return false
+}
+
+// TruncatedKey is the conventional key for WithTruncatedKey.
+const TruncatedKey = "_truncated"
+
+// WithFieldLimit stores at most n keys in a record, which keeps a line with a
+// huge number of pairs from growing its record without bound.  a pair whose
+// key would be one too many is dropped and counted in Stats.Dropped, though
+// one whose key the record already holds is stored as usual.  with
+// WithNestedKeys a nested map counts as a single key.  the default of zero
+// means no limit.
+func WithFieldLimit(n int) func(*Parser) error {
+	return func(p *Parser) error {
+		if n < 0 {
+			return fmt.Errorf("field limit must not be negative; got %d", n)
+		}
+		p.fieldLimit = n
+		return nil
+	}
+}
+
+// WithTruncatedKey stores true under key, typically TruncatedKey, in each
+// record that had pairs dropped by WithFieldLimit.  the flag doesn't count
+// towards the limit.
+func WithTruncatedKey(key string) func(*Parser) error {
+	return func(p *Parser) error {
+		p.truncatedKey = key
+		return nil
+	}
+}
+
+// withinLimit reports whether a pair with key may be stored in kvp without
+// going over the field limit, counting and flagging it if not.
+func (p *Parser) withinLimit(kvp map[string]interface{}, key string) bool {
+	if p.fieldLimit == 0 {
+		return true
+	}
+
+	if p.nestedKeys {
+		key = strings.SplitN(key, ".", 2)[0]
+	}
+	if _, exists := kvp[key]; exists {
+		return true
+	}
+
+	n := len(kvp)
+	if _, flagged := kvp[p.truncatedKey]; p.truncatedKey != "" && flagged {
+		n--
+	}
+	if n < p.fieldLimit {
+		return true
+	}
+
+	p.stats.Dropped++
+	p.logf(lex.LevelInfo, "key %q is past the limit of %d fields", key, p.fieldLimit)
+	if p.truncatedKey != "" {
+		kvp[p.truncatedKey] = true
+	}
+	return false
+}
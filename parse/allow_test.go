@@ -0,0 +1,156 @@
+package parse
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAllowedKeys(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		opts     []func(*Parser) error
+		expected []map[string]interface{}
+		stats    Stats
+	}{
+		"Drop": {
+			input:    "a=1 evil1=x b=2 evil2=y\n",
+			opts:     []func(*Parser) error{WithAllowedKeys("a", "b")},
+			expected: []map[string]interface{}{{"a": int64(1), "b": int64(2)}},
+			stats:    Stats{Lines: 1, Records: 1, Dropped: 2},
+		},
+		"Error": {
+			input:    "a=1 evil=x\n",
+			opts:     []func(*Parser) error{WithAllowedKeys("a"), WithOnDisallowed(DisallowedError)},
+			expected: []map[string]interface{}{{"a": int64(1)}},
+			stats:    Stats{Lines: 1, Records: 1, Errors: 1, Dropped: 1},
+		},
+		"Nothing Allowed": {
+			input:    "evil=x\n",
+			opts:     []func(*Parser) error{WithAllowedKeys()},
+			expected: []map[string]interface{}{{}},
+			stats:    Stats{Lines: 1, Empty: 1, Dropped: 1},
+		},
+		"After Key Transform": {
+			input:    "A=1 B=2\n",
+			opts:     []func(*Parser) error{WithAllowedKeys("a"), WithKeyTransform(strings.ToLower)},
+			expected: []map[string]interface{}{{"a": int64(1)}},
+			stats:    Stats{Lines: 1, Records: 1, Dropped: 1},
+		},
+		"Nested": {
+			input:    "http.status=200 http.evil=x\n",
+			opts:     []func(*Parser) error{WithAllowedKeys("http.status"), WithNestedKeys(true)},
+			expected: []map[string]interface{}{{"http": map[string]interface{}{"status": int64(200)}}},
+			stats:    Stats{Lines: 1, Records: 1, Dropped: 1},
+		},
+		"JSON": {
+			input:    `{"a":1,"evil":2}` + "\n",
+			opts:     []func(*Parser) error{WithAllowedKeys("a"), WithJSONInput(true)},
+			expected: []map[string]interface{}{{"a": int64(1)}},
+			stats:    Stats{Lines: 1, Records: 1, Dropped: 1},
+		},
+		"Everything Allowed By Default": {
+			input:    "a=1 evil=x\n",
+			expected: []map[string]interface{}{{"a": int64(1), "evil": "x"}},
+			stats:    Stats{Lines: 1, Records: 1},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			opts := append([]func(*Parser) error{WithReader(strings.NewReader(test.input)), WithErrorHandler(func(error) {})}, test.opts...)
+			p, err := NewParser(opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := []map[string]interface{}{}
+			for m := range p.Parse() {
+				got = append(got, m)
+			}
+
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("parsing %q yielded %#v; expected %#v", test.input, got, test.expected)
+			}
+			if stats := p.Stats(); stats != test.stats {
+				t.Fatalf("parsing %q yielded stats %+v; expected %+v", test.input, stats, test.stats)
+			}
+		})
+	}
+}
+
+func TestFieldLimit(t *testing.T) {
+	ten := "a=1 b=2 c=3 d=4 e=5 f=6 g=7 h=8 i=9 j=10\n"
+
+	tests := map[string]struct {
+		input    string
+		opts     []func(*Parser) error
+		expected map[string]interface{}
+		dropped  int
+	}{
+		"Ten Pairs": {
+			input:    ten,
+			opts:     []func(*Parser) error{WithFieldLimit(3)},
+			expected: map[string]interface{}{"a": int64(1), "b": int64(2), "c": int64(3)},
+			dropped:  7,
+		},
+		"Flagged": {
+			input:    ten,
+			opts:     []func(*Parser) error{WithFieldLimit(3), WithTruncatedKey(TruncatedKey)},
+			expected: map[string]interface{}{"a": int64(1), "b": int64(2), "c": int64(3), TruncatedKey: true},
+			dropped:  7,
+		},
+		"Within Limit": {
+			input:    "a=1 b=2\n",
+			opts:     []func(*Parser) error{WithFieldLimit(3), WithTruncatedKey(TruncatedKey)},
+			expected: map[string]interface{}{"a": int64(1), "b": int64(2)},
+		},
+		"Repeated Key": {
+			input:    "a=1 b=2 a=3 c=4\n",
+			opts:     []func(*Parser) error{WithFieldLimit(2), WithMultiValue(true)},
+			expected: map[string]interface{}{"a": []interface{}{int64(1), int64(3)}, "b": int64(2)},
+			dropped:  1,
+		},
+		"Nested": {
+			input:    "http.a=1 http.b=2 c=3\n",
+			opts:     []func(*Parser) error{WithFieldLimit(1), WithNestedKeys(true)},
+			expected: map[string]interface{}{"http": map[string]interface{}{"a": int64(1), "b": int64(2)}},
+			dropped:  1,
+		},
+		"No Limit": {
+			input:    "a=1 b=2\n",
+			expected: map[string]interface{}{"a": int64(1), "b": int64(2)},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := NewParser(append([]func(*Parser) error{WithReader(strings.NewReader(test.input))}, test.opts...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := []map[string]interface{}{}
+			for m := range p.Parse() {
+				got = append(got, m)
+			}
+
+			if expected := []map[string]interface{}{test.expected}; !reflect.DeepEqual(got, expected) {
+				t.Fatalf("parsing %q yielded %#v; expected %#v", test.input, got, expected)
+			}
+			if dropped := p.Stats().Dropped; dropped != test.dropped {
+				t.Fatalf("parsing %q dropped %d pairs; expected %d", test.input, dropped, test.dropped)
+			}
+		})
+	}
+
+	if _, err := NewParser(WithFieldLimit(-1)); err == nil {
+		t.Fatal("a negative field limit was accepted")
+	}
+}
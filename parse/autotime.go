@@ -0,0 +1,56 @@
+package parse
+
+import "time"
+
+// autoTimeLayouts are the layouts WithAutoTimeField tries on strings, most
+// likely first.  RFC3339 parses fractional seconds too, so RFC3339Nano is only
+// needed for the odd value that isn't quite RFC3339.
+var autoTimeLayouts = []string{
+	time.RFC3339,
+	time.RFC3339Nano,
+	"02/Jan/2006:15:04:05 -0700", // apache common log format
+}
+
+// the range of plausible unix times, between 2001 and 2286, in seconds and in
+// milliseconds.
+const (
+	minEpochSeconds = 1e9
+	maxEpochSeconds = 1e10
+	minEpochMillis  = minEpochSeconds * 1000
+	maxEpochMillis  = maxEpochSeconds * 1000
+)
+
+// WithAutoTimeField parses the values of keys as a time.Time without being
+// told their layout.  a string is tried as RFC3339, RFC3339Nano and then the apache
+// common log format, such as "10/Oct/2000:13:55:36 -0700".  an integer is
+// taken as a unix time in seconds or milliseconds, told apart by magnitude:
+// only values between 2001 and 2286 in either unit are plausible.  unix times
+// are stored in UTC.  a value that matches none of these is kept.
+func WithAutoTimeField(keys ...string) func(*Parser) error {
+	return func(p *Parser) error {
+		for _, key := range keys {
+			p.autoTimeFields[key] = true
+		}
+		return nil
+	}
+}
+
+// autoTime returns the time value stands for, if it looks like one.
+func autoTime(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case string:
+		for _, layout := range autoTimeLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, true
+			}
+		}
+	case int64:
+		switch {
+		case v >= minEpochSeconds && v < maxEpochSeconds:
+			return time.Unix(v, 0).UTC(), true
+		case v >= minEpochMillis && v < maxEpochMillis:
+			return time.Unix(v/1000, v%1000*int64(time.Millisecond)).UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
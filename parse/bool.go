@@ -0,0 +1,46 @@
+package parse
+
+import "strings"
+
+// boolLiterals is the set of values WithBoolValues recognizes.
+var boolLiterals = map[string]bool{
+	"true":  true,
+	"false": false,
+	"yes":   true,
+	"no":    false,
+	"on":    true,
+	"off":   false,
+}
+
+// WithBoolValues turns the values true, yes and on into the bool true, and
+// false, no and off into false.  case doesn't matter.  any other value is left
+// as it is.  WithBoolLiterals changes the set of values recognized.
+func WithBoolValues(bools bool) func(*Parser) error {
+	return func(p *Parser) error {
+		p.boolLiterals = nil
+		if bools {
+			p.boolLiterals = boolLiterals
+		}
+		return nil
+	}
+}
+
+// WithBoolLiterals is like WithBoolValues(true) but recognizes the keys of
+// literals, ignoring case, in place of the default set.  each value is turned
+// into the bool it maps to.
+func WithBoolLiterals(literals map[string]bool) func(*Parser) error {
+	return func(p *Parser) error {
+		p.boolLiterals = make(map[string]bool, len(literals))
+		for literal, b := range literals {
+			p.boolLiterals[strings.ToLower(literal)] = b
+		}
+		return nil
+	}
+}
+
+// parseBool returns the bool s stands for, if it is one of the parser's bool
+// literals.
+func (p *Parser) parseBool(s string) (bool, bool) {
+	b, ok := p.boolLiterals[strings.ToLower(s)]
+	return b, ok
+}
@@ -0,0 +1,56 @@
+package parse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBoolValues(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		opts     []func(*Parser) error
+		expected map[string]interface{}
+	}{
+		"Default Set": {
+			input:    "enabled=true done=no other=maybe\n",
+			opts:     []func(*Parser) error{WithBoolValues(true)},
+			expected: map[string]interface{}{"enabled": true, "done": false, "other": "maybe"},
+		},
+		"Case": {
+			input:    "a=TRUE b=Off\n",
+			opts:     []func(*Parser) error{WithBoolValues(true)},
+			expected: map[string]interface{}{"a": true, "b": false},
+		},
+		"Off By Default": {
+			input:    "enabled=true\n",
+			expected: map[string]interface{}{"enabled": "true"},
+		},
+		"Turned Off": {
+			input:    "enabled=true\n",
+			opts:     []func(*Parser) error{WithBoolValues(true), WithBoolValues(false)},
+			expected: map[string]interface{}{"enabled": "true"},
+		},
+		"Custom Set": {
+			input:    "a=Y b=n c=yes\n",
+			opts:     []func(*Parser) error{WithBoolLiterals(map[string]bool{"y": true, "N": false})},
+			expected: map[string]interface{}{"a": true, "b": false, "c": "yes"},
+		},
+		"Numbers Untouched": {
+			input:    "a=1 b=0\n",
+			opts:     []func(*Parser) error{WithBoolValues(true)},
+			expected: map[string]interface{}{"a": int64(1), "b": int64(0)},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := parseAll(t, test.input, test.opts...)
+			if expected := []map[string]interface{}{test.expected}; !reflect.DeepEqual(got, expected) {
+				t.Fatalf("parsing %q yielded %#v; expected %#v", test.input, got, expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package parse
+
+import "fmt"
+
+// ContinuationKey is the key under which WithContinuation stores the lines that
+// continue a record.
+const ContinuationKey = "_continuation"
+
+// WithContinuation treats a line that starts with white space, such as a line
+// of a stack trace, as a continuation of the record before it rather than as a
+// line of pairs.  continuation lines are stored under ContinuationKey as they
+// were written, joined by newlines.  a record is therefore only emitted once
+// the line after it has begun, or the input has ended.  a line that starts with
+// white space but has no record before it is parsed as usual.  it has no effect
+// on JSON input or when the input comes from WithLexer.
+func WithContinuation(cont bool) func(*Parser) error {
+	return func(p *Parser) error {
+		p.continuation = cont
+		return nil
+	}
+}
+
+// continueRecord appends text, the text of a continuation line, to kvp.  with
+// WithRawLine the line is appended to the record's raw text too.
+func (p *Parser) continueRecord(kvp map[string]interface{}, text string) {
+	if prev, exists := kvp[ContinuationKey]; exists {
+		kvp[ContinuationKey] = fmt.Sprintf("%v\n%s", prev, text)
+	} else {
+		kvp[ContinuationKey] = text
+	}
+
+	if s, isString := kvp[RawKey].(string); isString && p.rawLine {
+		kvp[RawKey] = s + string(p.delimiter) + text
+	}
+}
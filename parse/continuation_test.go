@@ -0,0 +1,56 @@
+package parse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestContinuation(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		opts     []func(*Parser) error
+		expected []map[string]interface{}
+	}{
+		"Stack Trace": {
+			input: "level=error msg=panic\n\tat main.go:10\n\tat \"unterminated\n  at run.go:3\nlevel=info msg=ok\n",
+			expected: []map[string]interface{}{
+				{"level": "error", "msg": "panic", ContinuationKey: "\tat main.go:10\n\tat \"unterminated\n  at run.go:3"},
+				{"level": "info", "msg": "ok"},
+			},
+		},
+		"First Line": {
+			input:    "  a=1\n b=2\n",
+			expected: []map[string]interface{}{{"a": int64(1), ContinuationKey: " b=2"}},
+		},
+		"After A Blank Line": {
+			input:    "a=1\n\n  b=2\n",
+			expected: []map[string]interface{}{{"a": int64(1)}, {}, {"b": int64(2)}},
+		},
+		"At EOF": {
+			input:    "a=1\n  more",
+			expected: []map[string]interface{}{{"a": int64(1), ContinuationKey: "  more"}},
+		},
+		"Raw Line": {
+			input:    "a=1\n  more\n",
+			opts:     []func(*Parser) error{WithRawLine(true)},
+			expected: []map[string]interface{}{{"a": int64(1), ContinuationKey: "  more", RawKey: "a=1\n  more"}},
+		},
+		"Off": {
+			input:    "a=1\n  b=2\n",
+			opts:     []func(*Parser) error{WithContinuation(false)},
+			expected: []map[string]interface{}{{"a": int64(1)}, {"b": int64(2)}},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := parseAll(t, test.input, append([]func(*Parser) error{WithContinuation(true)}, test.opts...)...)
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("parsing %q yielded %#v; expected %#v", test.input, got, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package parse
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Decoder reads records from an input stream and stores them in Go values,
+// in the manner of encoding/json's Decoder.
+type Decoder struct {
+	r    io.Reader
+	opts []func(*Parser) error
+
+	// records delivers the records of the input.  err is set before it is
+	// closed.
+	records chan map[string]interface{}
+	err     error
+}
+
+// NewDecoder returns a decoder that reads from r.  the options configure the
+// parser it reads through, as they would NewParser.
+func NewDecoder(r io.Reader, opts ...func(*Parser) error) *Decoder {
+	return &Decoder{r: r, opts: opts}
+}
+
+// start begins parsing the input.  parsing runs a record ahead of Decode, so
+// a decoder that is abandoned before the end of its input leaves a goroutine
+// blocked, much as Parse() does.
+func (d *Decoder) start() {
+	d.records = make(chan map[string]interface{})
+
+	p, err := NewParser(append([]func(*Parser) error{WithReader(d.r)}, d.opts...)...)
+	if err != nil {
+		d.err = err
+		close(d.records)
+		return
+	}
+
+	go func() {
+		d.err = p.ParseFunc(func(m map[string]interface{}) error {
+			d.records <- m
+			return nil
+		})
+		close(d.records)
+	}()
+}
+
+// Decode reads the next record and stores it in the value pointed to by v,
+// which is either a map with string keys or a struct.  it returns io.EOF once
+// the input has no more records.
+//
+// a key is stored in the struct field whose logfmt tag names it, as in
+// `logfmt:"status"`, or else in the field of the same name, ignoring case.  a
+// field tagged "-" is left alone, as is a field whose key the record lacks.  a
+// value that can't be stored in its field, such as a string in an int field,
+// fails with a *DecodeError, leaving the fields before it set.
+func (d *Decoder) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("decode needs a non-nil pointer; got %T", v)
+	}
+	if k := rv.Elem().Kind(); k != reflect.Map && k != reflect.Struct {
+		return fmt.Errorf("decode needs a pointer to a map or a struct; got %T", v)
+	}
+
+	if d.records == nil {
+		d.start()
+	}
+
+	m, ok := <-d.records
+	if !ok {
+		if d.err != nil {
+			return d.err
+		}
+		return io.EOF
+	}
+	return decodeValue(rv.Elem(), "", m)
+}
+
+// DecodeError reports a value that can't be stored in the Go value it was
+// meant for.
+type DecodeError struct {
+	Key   string
+	Value interface{}
+	Type  reflect.Type
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("cannot decode value %v (%T) of key %q into %v", e.Value, e.Value, e.Key, e.Type)
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+// decodeValue stores value, found under key, in dst.
+func decodeValue(dst reflect.Value, key string, value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	mismatch := &DecodeError{Key: key, Value: value, Type: dst.Type()}
+
+	src := reflect.ValueOf(value)
+	if src.Type().AssignableTo(dst.Type()) {
+		dst.Set(src)
+		return nil
+	}
+
+	s, isString := value.(string)
+
+	// types that have a kind of their own come first.
+	switch dst.Type() {
+	case durationType:
+		if !isString {
+			return mismatch
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return mismatch
+		}
+		dst.SetInt(int64(d))
+		return nil
+
+	case timeType:
+		if !isString {
+			return mismatch
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return mismatch
+		}
+		dst.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.String:
+		switch value.(type) {
+		case int64, float64, bool:
+			// logfmt is untyped, so id=123 is as good a string as id="123".
+			dst.SetString(fmt.Sprint(value))
+			return nil
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, isInt := value.(int64); isInt && !dst.OverflowInt(n) {
+			dst.SetInt(n)
+			return nil
+		}
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n, isInt := value.(int64); isInt && n >= 0 && !dst.OverflowUint(uint64(n)) {
+			dst.SetUint(uint64(n))
+			return nil
+		}
+
+	case reflect.Float32, reflect.Float64:
+		switch n := value.(type) {
+		case float64:
+			dst.SetFloat(n)
+			return nil
+		case int64:
+			dst.SetFloat(float64(n))
+			return nil
+		}
+
+	case reflect.Bool:
+		if b, isBool := boolLiterals[strings.ToLower(s)]; isString && isBool {
+			dst.SetBool(b)
+			return nil
+		}
+
+	case reflect.Ptr:
+		elem := reflect.New(dst.Type().Elem())
+		if err := decodeValue(elem.Elem(), key, value); err != nil {
+			return err
+		}
+		dst.Set(elem)
+		return nil
+
+	case reflect.Slice:
+		// a repeated key, a list or a lone value.
+		elems := reflect.ValueOf(value)
+		if k := elems.Kind(); k != reflect.Slice && k != reflect.Array {
+			elems = reflect.ValueOf([]interface{}{value})
+		}
+		slice := reflect.MakeSlice(dst.Type(), elems.Len(), elems.Len())
+		for i := 0; i < elems.Len(); i++ {
+			if err := decodeValue(slice.Index(i), key, elems.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		dst.Set(slice)
+		return nil
+
+	case reflect.Map:
+		m, isMap := value.(map[string]interface{})
+		if !isMap || dst.Type().Key().Kind() != reflect.String {
+			return mismatch
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMapWithSize(dst.Type(), len(m)))
+		}
+		for k, v := range m {
+			elem := reflect.New(dst.Type().Elem()).Elem()
+			if err := decodeValue(elem, joinKey(key, k), v); err != nil {
+				return err
+			}
+			dst.SetMapIndex(reflect.ValueOf(k).Convert(dst.Type().Key()), elem)
+		}
+		return nil
+
+	case reflect.Struct:
+		// a nested map, as built by WithNestedKeys.
+		if m, isMap := value.(map[string]interface{}); isMap {
+			return decodeStruct(dst, key, m)
+		}
+	}
+	return mismatch
+}
+
+// decodeStruct stores the values of m in the fields of the struct dst.
+func decodeStruct(dst reflect.Value, prefix string, m map[string]interface{}) error {
+	rec := NewRecord(m)
+
+	t := dst.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			// unexported.
+			continue
+		}
+
+		name := field.Name
+		if tag := field.Tag.Get("logfmt"); tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+
+		value, exists := rec.Get(name)
+		if !exists {
+			continue
+		}
+		if err := decodeValue(dst.Field(i), joinKey(prefix, name), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// joinKey returns the dotted key of name within prefix.
+func joinKey(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
@@ -0,0 +1,97 @@
+package parse
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodeStruct(t *testing.T) {
+	type request struct {
+		Status  int           `logfmt:"status"`
+		Method  string        `logfmt:"method"`
+		Took    time.Duration `logfmt:"took"`
+		Ratio   float64
+		ID      string `logfmt:"id"`
+		OK      bool   `logfmt:"ok"`
+		Tags    []string
+		Ignored string `logfmt:"-"`
+		Missing *int
+	}
+
+	input := "status=200 method=GET took=15ms ratio=0.5 id=123 ok=true tags=a tags=b Ignored=x\nstatus=404\n"
+	d := NewDecoder(strings.NewReader(input), WithMultiValue(true))
+
+	expected := []request{
+		{Status: 200, Method: "GET", Took: 15 * time.Millisecond, Ratio: 0.5, ID: "123", OK: true, Tags: []string{"a", "b"}},
+		{Status: 404},
+	}
+	for i, want := range expected {
+		var got request
+		if err := d.Decode(&got); err != nil {
+			t.Fatalf("record %d: .Decode() returned error %v", i, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("record %d: .Decode() yielded %#v; expected %#v", i, got, want)
+		}
+	}
+
+	var got request
+	if err := d.Decode(&got); err != io.EOF {
+		t.Fatalf(".Decode() at the end of the input returned error %v; expected %v", err, io.EOF)
+	}
+}
+
+func TestDecodeMap(t *testing.T) {
+	d := NewDecoder(strings.NewReader("a=1 b=two\n"))
+
+	var got map[string]interface{}
+	if err := d.Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]interface{}{"a": int64(1), "b": "two"}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf(".Decode() yielded %#v; expected %#v", got, expected)
+	}
+
+	if err := d.Decode(&got); err != io.EOF {
+		t.Fatalf(".Decode() at the end of the input returned error %v; expected %v", err, io.EOF)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		target   interface{}
+		mismatch bool
+	}{
+		"String In Int": {input: "n=abc\n", target: &struct{ N int }{}, mismatch: true},
+		"Overflow":      {input: "n=300\n", target: &struct{ N int8 }{}, mismatch: true},
+		"Negative Uint": {input: "n=-1\n", target: &struct{ N uint }{}, mismatch: true},
+		"Not A Bool":    {input: "b=maybe\n", target: &struct{ B bool }{}, mismatch: true},
+		"Bad Duration":  {input: "d=soon\n", target: &struct{ D time.Duration }{}, mismatch: true},
+		"Typed Map":     {input: "a=x\n", target: &map[string]int{}, mismatch: true},
+		"Not A Pointer": {input: "a=1\n", target: struct{ A int }{}},
+		"Nil Pointer":   {input: "a=1\n", target: (*struct{ A int })(nil)},
+		"Not A Record":  {input: "a=1\n", target: new(int)},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			err := NewDecoder(strings.NewReader(test.input)).Decode(test.target)
+			if err == nil {
+				t.Fatalf("decoding %q into %T succeeded", test.input, test.target)
+			}
+
+			var decodeErr *DecodeError
+			if errors.As(err, &decodeErr) != test.mismatch {
+				t.Fatalf("decoding %q into %T returned error %v; expected a *DecodeError: %v", test.input, test.target, err, test.mismatch)
+			}
+		})
+	}
+}
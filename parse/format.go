@@ -0,0 +1,137 @@
+package parse
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Format renders m as a canonical logfmt line: key=value pairs separated by a
+// single space and sorted by key.  it is the inverse of the parser:
+//   - strings are quoted when they contain spaces, quotes, separators or
+//     anything else that would not survive being parsed as a bare atom.
+//   - keys are quoted by the same rules, so "full name" survives.
+//   - numbers are written without quotes.
+//   - nested maps are flattened into dotted keys, as WithNestedKeys reads
+//     them.
+//   - slices repeat their key once per element, as WithMultiValue reads them.
+//
+// a nil or empty map yields an empty string.
+func Format(m map[string]interface{}) string {
+	sb := &strings.Builder{}
+	formatMap(sb, "", m)
+	return sb.String()
+}
+
+func formatMap(sb *strings.Builder, prefix string, m map[string]interface{}) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		formatValue(sb, prefix+k, m[k])
+	}
+}
+
+func formatValue(sb *strings.Builder, key string, v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		formatMap(sb, key+".", v)
+		return
+	case []interface{}:
+		for _, elem := range v {
+			formatValue(sb, key, elem)
+		}
+		return
+	}
+
+	if sb.Len() > 0 {
+		sb.WriteByte(' ')
+	}
+	sb.WriteString(quoteKey(key))
+	sb.WriteByte('=')
+
+	switch v := v.(type) {
+	case int64, int:
+		fmt.Fprint(sb, v)
+	case float64:
+		sb.WriteString(formatFloat(v, 64))
+	case float32:
+		sb.WriteString(formatFloat(float64(v), 32))
+	case string:
+		sb.WriteString(quote(v))
+	default:
+		sb.WriteString(quote(fmt.Sprint(v)))
+	}
+}
+
+// formatFloat formats f so that it is parsed back as a float: a whole number
+// gets a trailing ".0" so it isn't mistaken for an integer.
+func formatFloat(f float64, bits int) string {
+	s := strconv.FormatFloat(f, 'g', -1, bits)
+	if !strings.ContainsAny(s, ".en") {
+		s += ".0"
+	}
+	return s
+}
+
+// quote returns s as-is if it would be parsed back as the same string, and as
+// a double quoted string with escaped quotes and backslashes otherwise.
+func quote(s string) string {
+	if !needsQuotes(s) {
+		return s
+	}
+	return quoted(s)
+}
+
+// quoteKey is quote for keys, which must also be quoted if they hold a
+// separator anywhere.
+func quoteKey(k string) string {
+	if !needsQuotes(k) && !strings.ContainsRune(k, '=') {
+		return k
+	}
+	return quoted(k)
+}
+
+// quoted returns s as a double quoted string with escaped quotes and
+// backslashes.
+func quoted(s string) string {
+	sb := &strings.Builder{}
+	sb.WriteByte('"')
+	for _, r := range s {
+		if r == '"' || r == '\\' {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+func needsQuotes(s string) bool {
+	if s == "" {
+		return true
+	}
+
+	// a bare string that looks like a number would come back as one.
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return true
+	}
+	if _, err := strconv.ParseInt(s, 0, 64); err == nil {
+		return true
+	}
+
+	for i, r := range s {
+		if unicode.IsSpace(r) || !unicode.IsPrint(r) || r == '"' || r == '\'' || r == '`' || r == '\\' {
+			return true
+		}
+		if i == 0 && r == '=' {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package parse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := map[string]struct {
+		input    map[string]interface{}
+		expected string
+	}{
+		"Nil":          {input: nil, expected: ""},
+		"Empty":        {input: map[string]interface{}{}, expected: ""},
+		"Sorted Keys":  {input: map[string]interface{}{"b": "x", "a": "y"}, expected: "a=y b=x"},
+		"Numbers":      {input: map[string]interface{}{"n": int64(42), "f": 0.5}, expected: "f=0.5 n=42"},
+		"Spaces":       {input: map[string]interface{}{"msg": "hello world"}, expected: `msg="hello world"`},
+		"Quotes":       {input: map[string]interface{}{"msg": `say "hi"`}, expected: `msg="say \"hi\""`},
+		"Empty Value":  {input: map[string]interface{}{"msg": ""}, expected: `msg=""`},
+		"Numeric Text": {input: map[string]interface{}{"id": "42"}, expected: `id="42"`},
+		"Nested":       {input: map[string]interface{}{"a": map[string]interface{}{"b": "1x"}}, expected: "a.b=1x"},
+		"Multi Value":  {input: map[string]interface{}{"tag": []interface{}{"a", "b"}}, expected: "tag=a tag=b"},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := Format(test.input); got != test.expected {
+				t.Fatalf("Format(%v) yielded %q; expected %q", test.input, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	tests := map[string]struct {
+		input string
+	}{
+		"Plain":       {input: "a=1 b=two c=3.5\n"},
+		"Quoted":      {input: `msg="hello world" q='single quoted' path=/a/b` + "\n"},
+		"Escapes":     {input: `msg="say \"hi\" \\ bye"` + "\n"},
+		"Padding":     {input: "token=YWJj== id=\"42\"\n"},
+		"Backticks":   {input: "cmd=`echo \"hi\"`\n"},
+		"Quoted Key":  {input: `"full name"="Jane Doe" "a=b"=1` + "\n"},
+		"Whole Float": {input: "a=1.0 b=1e3 c=-2.0\n"},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			first := parseAll(t, test.input)
+			if len(first) != 1 {
+				t.Fatalf("parsing %q yielded %d records; expected 1", test.input, len(first))
+			}
+
+			line := Format(first[0])
+			second := parseAll(t, line+"\n")
+
+			if !reflect.DeepEqual(first, second) {
+				t.Fatalf("%q was formatted as %q which parsed as %#v; expected %#v", test.input, line, second, first)
+			}
+		})
+	}
+}
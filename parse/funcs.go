@@ -0,0 +1,102 @@
+package parse
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// FuncMap returns the helper functions made available to ginsu templates:
+//   - upper and lower change the case of a value's string form.
+//   - default yields its argument when the piped value is missing or empty,
+//     e.g. {{.level | default "info"}}.
+//   - numf formats a value as a number, parsing it first if it is a string,
+//     e.g. {{numf "%.2f" .latency}}.
+//   - ptr looks up the value at a JSON pointer, walking nested maps and the
+//     indices of lists, e.g. {{ptr "/http/headers/0" .}}.  a path that
+//     isn't there yields an empty string.
+//   - sortedKeys lists the keys of a record in sorted order, nested keys as
+//     dotted paths, e.g. {{range sortedKeys .}}{{.}}={{index $ .}} {{end}}.
+//
+// a fresh map is returned on each call, so embedders are free to add their own
+// entries or to layer another map on top with (*template.Template).Funcs.
+func FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"upper":      func(v interface{}) string { return strings.ToUpper(fmt.Sprint(v)) },
+		"lower":      func(v interface{}) string { return strings.ToLower(fmt.Sprint(v)) },
+		"default":    defaultValue,
+		"numf":       numf,
+		"ptr":        pointer,
+		"sortedKeys": sortedKeys,
+	}
+}
+
+// sortedKeys returns the keys of m as Record.SortedKeys does, so ranging over
+// them gives the same order on every run.
+func sortedKeys(m map[string]interface{}) []string {
+	return NewRecord(m).SortedKeys()
+}
+
+func defaultValue(def interface{}, v interface{}) interface{} {
+	if v == nil {
+		return def
+	}
+	if s, isString := v.(string); isString && s == "" {
+		return def
+	}
+	return v
+}
+
+func numf(format string, v interface{}) (string, error) {
+	s, isString := v.(string)
+	if !isString {
+		return fmt.Sprintf(format, v), nil
+	}
+
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return fmt.Sprintf(format, i), nil
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return "", fmt.Errorf("numf: %q is not a number", s)
+	}
+	return fmt.Sprintf(format, f), nil
+}
+
+// pointer returns the value at ptr, a JSON pointer such as /a/b/0, within v.
+// any step of the path that isn't there, say a missing key or an index past
+// the end of a list, yields an empty string rather than an error, so templates
+// can be run over records of differing shapes.
+func pointer(ptr string, v interface{}) (interface{}, error) {
+	if ptr == "" {
+		return v, nil
+	}
+	if ptr[0] != '/' {
+		return nil, fmt.Errorf("ptr: %q does not start with /", ptr)
+	}
+
+	unescape := strings.NewReplacer("~1", "/", "~0", "~")
+	for _, step := range strings.Split(ptr[1:], "/") {
+		step = unescape.Replace(step)
+
+		switch node := v.(type) {
+		case map[string]interface{}:
+			next, exists := node[step]
+			if !exists {
+				return "", nil
+			}
+			v = next
+		case []interface{}:
+			i, err := strconv.Atoi(step)
+			if err != nil || i < 0 || i >= len(node) {
+				return "", nil
+			}
+			v = node[i]
+		default:
+			return "", nil
+		}
+	}
+	return v, nil
+}
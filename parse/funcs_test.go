@@ -0,0 +1,69 @@
+package parse
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestFuncMap(t *testing.T) {
+	tests := map[string]struct {
+		tmpl     string
+		data     map[string]interface{}
+		expected string
+	}{
+		"Upper":            {tmpl: `{{.level | upper}}`, data: map[string]interface{}{"level": "info"}, expected: "INFO"},
+		"Lower":            {tmpl: `{{.level | lower}}`, data: map[string]interface{}{"level": "WARN"}, expected: "warn"},
+		"Default Missing":  {tmpl: `{{.level | default "none"}}`, data: map[string]interface{}{}, expected: "none"},
+		"Default Empty":    {tmpl: `{{.level | default "none"}}`, data: map[string]interface{}{"level": ""}, expected: "none"},
+		"Default Present":  {tmpl: `{{.level | default "none"}}`, data: map[string]interface{}{"level": "debug"}, expected: "debug"},
+		"Numf String":      {tmpl: `{{numf "%.2f" .latency}}`, data: map[string]interface{}{"latency": "0.5"}, expected: "0.50"},
+		"Numf Int String":  {tmpl: `{{numf "%05d" .status}}`, data: map[string]interface{}{"status": "200"}, expected: "00200"},
+		"Numf Typed Value": {tmpl: `{{numf "%.1f" .latency}}`, data: map[string]interface{}{"latency": 1.25}, expected: "1.2"},
+		"Ptr Nested":       {tmpl: `{{ptr "/http/status" .}}`, data: map[string]interface{}{"http": map[string]interface{}{"status": int64(200), "hosts": []interface{}{"a", "b"}, "a/b": "slash", "m~n": "tilde"}}, expected: "200"},
+		"Ptr Index":        {tmpl: `{{ptr "/http/hosts/1" .}}`, data: map[string]interface{}{"http": map[string]interface{}{"status": int64(200), "hosts": []interface{}{"a", "b"}, "a/b": "slash", "m~n": "tilde"}}, expected: "b"},
+		"Ptr Escapes":      {tmpl: `{{ptr "/http/a~1b" .}} {{ptr "/http/m~0n" .}}`, data: map[string]interface{}{"http": map[string]interface{}{"status": int64(200), "hosts": []interface{}{"a", "b"}, "a/b": "slash", "m~n": "tilde"}}, expected: "slash tilde"},
+		"Ptr Whole":        {tmpl: `{{ptr "" . | len}}`, data: map[string]interface{}{"http": map[string]interface{}{"status": int64(200), "hosts": []interface{}{"a", "b"}, "a/b": "slash", "m~n": "tilde"}}, expected: "1"},
+		"Ptr Missing":      {tmpl: `[{{ptr "/http/nope/deeper" .}}]`, data: map[string]interface{}{"http": map[string]interface{}{"status": int64(200), "hosts": []interface{}{"a", "b"}, "a/b": "slash", "m~n": "tilde"}}, expected: "[]"},
+		"Ptr Past Value":   {tmpl: `[{{ptr "/http/status/x" .}}]`, data: map[string]interface{}{"http": map[string]interface{}{"status": int64(200), "hosts": []interface{}{"a", "b"}, "a/b": "slash", "m~n": "tilde"}}, expected: "[]"},
+		"Ptr Bad Index":    {tmpl: `[{{ptr "/http/hosts/2" .}}{{ptr "/http/hosts/x" .}}]`, data: map[string]interface{}{"http": map[string]interface{}{"status": int64(200), "hosts": []interface{}{"a", "b"}, "a/b": "slash", "m~n": "tilde"}}, expected: "[]"},
+		"Ptr Default":      {tmpl: `{{ptr "/http/method" . | default "GET"}}`, data: map[string]interface{}{"http": map[string]interface{}{"status": int64(200), "hosts": []interface{}{"a", "b"}, "a/b": "slash", "m~n": "tilde"}}, expected: "GET"},
+		"Sorted Keys":      {tmpl: `{{range sortedKeys .}}{{.}} {{end}}`, data: map[string]interface{}{"c": 1, "a": 2, "b": 3}, expected: "a b c "},
+		"Sorted Nested":    {tmpl: `{{range sortedKeys .}}{{.}} {{end}}`, data: map[string]interface{}{"b": map[string]interface{}{"d": 1, "c": 2}, "a": 3}, expected: "a b.c b.d "},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			tmpl, err := template.New("test").Funcs(FuncMap()).Parse(test.tmpl)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sb := &strings.Builder{}
+			if err := tmpl.Execute(sb, test.data); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := sb.String(); got != test.expected {
+				t.Fatalf("%s rendered %q; expected %q", test.tmpl, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestNumfRejectsNonNumbers(t *testing.T) {
+	tmpl := template.Must(template.New("numf").Funcs(FuncMap()).Parse(`{{numf "%d" .x}}`))
+	if err := tmpl.Execute(&strings.Builder{}, map[string]interface{}{"x": "abc"}); err == nil {
+		t.Fatal("numf accepted a value that is not a number")
+	}
+}
+
+func TestPtrRejectsRelativePointers(t *testing.T) {
+	tmpl := template.Must(template.New("ptr").Funcs(FuncMap()).Parse(`{{ptr "a/b" .}}`))
+	if err := tmpl.Execute(&strings.Builder{}, map[string]interface{}{"a": map[string]interface{}{"b": 1}}); err == nil {
+		t.Fatal("ptr accepted a pointer that does not start with /")
+	}
+}
@@ -0,0 +1,37 @@
+package parse
+
+import (
+	"fmt"
+	"io"
+)
+
+// GroupBy parses all of r and returns its records grouped by the string form
+// of their value of key, in the order they were read.  records that lack the
+// key are grouped under "", and empty records, such as those of blank lines,
+// are left out.  opts configure the parser as they would NewParser.
+//
+// unlike Parse(), GroupBy holds every record in memory, so it suits reports
+// over inputs of modest size.
+func GroupBy(r io.Reader, key string, opts ...func(*Parser) error) (map[string][]map[string]interface{}, error) {
+	p, err := NewParser(append([]func(*Parser) error{WithReader(r)}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := map[string][]map[string]interface{}{}
+	err = p.ParseFunc(func(m map[string]interface{}) error {
+		if len(m) == 0 {
+			return nil
+		}
+		group := ""
+		if v, exists := m[key]; exists {
+			group = fmt.Sprint(v)
+		}
+		groups[group] = append(groups[group], m)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
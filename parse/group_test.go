@@ -0,0 +1,40 @@
+package parse
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGroupBy(t *testing.T) {
+	input := strings.Join([]string{
+		"service=api status=200",
+		"service=db query=select",
+		"",
+		"status=500",
+		"service=api status=404",
+		"service=7 msg=numbered",
+	}, "\n") + "\n"
+
+	got, err := GroupBy(strings.NewReader(input), "service")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][]map[string]interface{}{
+		"api": {
+			{"service": "api", "status": int64(200)},
+			{"service": "api", "status": int64(404)},
+		},
+		"db": {{"service": "db", "query": "select"}},
+		"7":  {{"service": int64(7), "msg": "numbered"}},
+		"":   {{"status": int64(500)}},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("grouping %q by service yielded %#v; expected %#v", input, got, expected)
+	}
+
+	if _, err := GroupBy(strings.NewReader(input), "service", WithRecordCapacity(-1)); err == nil {
+		t.Fatal("GroupBy() accepted a bad option")
+	}
+}
@@ -0,0 +1,28 @@
+package parse
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+)
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Decompress sniffs the first bytes of r and, if they carry the gzip magic
+// number, returns a reader that yields the decompressed stream.  any other
+// input is returned unchanged (although buffered) so callers can use
+// Decompress unconditionally.
+func Decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+
+	magic, err := br.Peek(len(gzipMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if !bytes.Equal(magic, gzipMagic) {
+		return br, nil
+	}
+	return gzip.NewReader(br)
+}
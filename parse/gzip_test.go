@@ -0,0 +1,56 @@
+package parse
+
+import (
+	"bytes"
+	"compress/gzip"
+	"reflect"
+	"testing"
+)
+
+func TestDecompress(t *testing.T) {
+	const fixture = "a=1 b=2\nc=3\n"
+
+	compressed := &bytes.Buffer{}
+	zw := gzip.NewWriter(compressed)
+	if _, err := zw.Write([]byte(fixture)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		input []byte
+	}{
+		"Gzipped": {input: compressed.Bytes()},
+		"Plain":   {input: []byte(fixture)},
+	}
+
+	expected := []map[string]interface{}{{"a": int64(1), "b": int64(2)}, {"c": int64(3)}}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r, err := Decompress(bytes.NewReader(test.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p, err := NewParser(WithReader(r))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := []map[string]interface{}{}
+			for m := range p.Parse() {
+				got = append(got, m)
+			}
+
+			if !reflect.DeepEqual(got, expected) {
+				t.Fatalf("parsing yielded %#v; expected %#v", got, expected)
+			}
+		})
+	}
+}
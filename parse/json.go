@@ -0,0 +1,118 @@
+package parse
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+// WithJSONInput reads the input as JSON lines rather than logfmt.  each line
+// holds one object, which is flattened into dotted keys (an array element's key
+// ends in its index) and then stored just as parsed logfmt would be, so every
+// other option applies to it unchanged.
+func WithJSONInput(jsonInput bool) func(*Parser) error {
+	return func(p *Parser) error {
+		p.jsonInput = jsonInput
+		return nil
+	}
+}
+
+// byteOrderMark is the utf-8 encoding of the mark some windows tools begin
+// files with.  the lexer skips it for logfmt.
+var byteOrderMark = []byte("\uFEFF")
+
+func (p *Parser) parseJSON(emit func(map[string]interface{}) error) error {
+	br := bufio.NewReader(p.r)
+	for line := 1; ; line++ {
+		text, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		if len(text) == 0 && err == io.EOF {
+			return nil
+		}
+
+		p.stats.Lines++
+		if line == 1 {
+			text = bytes.TrimPrefix(text, byteOrderMark)
+		}
+
+		raw := bytes.TrimSuffix(text, []byte("\n"))
+
+		kvp := p.newRecord()
+		if text = bytes.TrimSpace(text); len(text) > 0 {
+			var decodeErr error
+			if !p.guard(line, func() { decodeErr = p.decodeJSON(kvp, text) }) {
+				p.stats.Skipped++
+				continue
+			}
+			if decodeErr != nil {
+				p.report(&LineError{Line: line, Err: decodeErr})
+				p.stats.Skipped++
+				continue
+			}
+		}
+
+		if p.lineKey != "" && len(kvp) > 0 {
+			kvp[p.lineKey] = line
+		}
+		if p.rawLine && len(kvp) > 0 {
+			kvp[RawKey] = string(raw)
+		}
+
+		if emitErr := emit(kvp); emitErr != nil {
+			return emitErr
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+func (p *Parser) decodeJSON(kvp map[string]interface{}, text []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(text))
+	dec.UseNumber()
+
+	var obj map[string]interface{}
+	if err := dec.Decode(&obj); err != nil {
+		return err
+	}
+
+	p.flatten(kvp, "", obj)
+	return nil
+}
+
+// flatten stores each leaf of v under its dotted path.
+func (p *Parser) flatten(kvp map[string]interface{}, key string, v interface{}) {
+	join := func(k string) string {
+		if key == "" {
+			return k
+		}
+		return key + "." + k
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, elem := range v {
+			p.flatten(kvp, join(k), elem)
+		}
+	case []interface{}:
+		for i, elem := range v {
+			p.flatten(kvp, join(strconv.Itoa(i)), elem)
+		}
+	case json.Number:
+		// type numbers the same way the lexer does.
+		if i, err := v.Int64(); err == nil {
+			p.store(kvp, key, i)
+			return
+		}
+		f, _ := v.Float64()
+		p.store(kvp, key, f)
+	default:
+		p.store(kvp, key, v)
+	}
+}
@@ -0,0 +1,64 @@
+package parse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestJSONInput(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		opts     []func(*Parser) error
+		expected []map[string]interface{}
+	}{
+		"Flat": {
+			input:    `{"a":1,"b":"two","c":1.5,"d":true,"e":null}` + "\n",
+			expected: []map[string]interface{}{{"a": int64(1), "b": "two", "c": 1.5, "d": true, "e": nil}},
+		},
+		"Nested Objects": {
+			input:    `{"http":{"request":{"method":"GET"},"status":200}}` + "\n",
+			expected: []map[string]interface{}{{"http.request.method": "GET", "http.status": int64(200)}},
+		},
+		"Arrays": {
+			input:    `{"tags":["a","b"],"pts":[{"x":1}]}` + "\n",
+			expected: []map[string]interface{}{{"tags.0": "a", "tags.1": "b", "pts.0.x": int64(1)}},
+		},
+		"Several Lines": {
+			input:    "{\"n\":1}\n\n{\"n\":2}",
+			expected: []map[string]interface{}{{"n": int64(1)}, {}, {"n": int64(2)}},
+		},
+		"Renested": {
+			input:    `{"a":{"b":1}}` + "\n",
+			opts:     []func(*Parser) error{WithNestedKeys(true)},
+			expected: []map[string]interface{}{{"a": map[string]interface{}{"b": int64(1)}}},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := parseAll(t, test.input, append([]func(*Parser) error{WithJSONInput(true)}, test.opts...)...)
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("parsing %q yielded %#v; expected %#v", test.input, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestJSONInputReportsBadLines(t *testing.T) {
+	var errs []error
+	got := parseAll(t, "{\"n\":1}\n{oops\n{\"n\":3}\n", WithJSONInput(true), WithErrorHandler(func(err error) { errs = append(errs, err) }))
+
+	if expected := []map[string]interface{}{{"n": int64(1)}, {"n": int64(3)}}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("parsing yielded %#v; expected %#v", got, expected)
+	}
+
+	if len(errs) != 1 {
+		t.Fatalf("parsing reported %v; expected one error", errs)
+	}
+	if lineErr, ok := errs[0].(*LineError); !ok || lineErr.Line != 2 {
+		t.Fatalf("parsing reported %v; expected an error on line 2", errs[0])
+	}
+}
@@ -0,0 +1,48 @@
+package parse
+
+import (
+	"errors"
+	"strings"
+)
+
+var errManyLines = errors.New("input holds more than one line")
+
+// Line parses s, a single line of logfmt such as a=1 b=two, and returns its
+// record.  a trailing newline is optional and an empty line yields an empty
+// record.  a line that holds an error, such as an unterminated quote or
+// unidentified input, is dropped: Line returns the first error along with an
+// empty record.  opts configure the parser as they would NewParser.
+func Line(s string, opts ...func(*Parser) error) (map[string]interface{}, error) {
+	var lineErr error
+	opts = append([]func(*Parser) error{
+		WithReader(strings.NewReader(s)),
+		WithOnUnidentified(UnidentifiedError),
+		WithErrorHandler(func(err error) {
+			if lineErr == nil {
+				lineErr = err
+			}
+		}),
+	}, opts...)
+
+	p, err := NewParser(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	var record map[string]interface{}
+	err = p.ParseFunc(func(m map[string]interface{}) error {
+		if record != nil {
+			return errManyLines
+		}
+		record = m
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if record == nil {
+		record = p.newRecord()
+	}
+	return record, lineErr
+}
@@ -0,0 +1,57 @@
+package parse
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/ayang64/ginsu/lex"
+)
+
+func TestLine(t *testing.T) {
+	tests := map[string]struct {
+		input     string
+		expected  map[string]interface{}
+		shouldErr bool
+	}{
+		"Well Formed":        {input: "a=1 b=two", expected: map[string]interface{}{"a": int64(1), "b": "two"}},
+		"Trailing Newline":   {input: "a=1\n", expected: map[string]interface{}{"a": int64(1)}},
+		"Empty":              {input: "", expected: map[string]interface{}{}},
+		"Unterminated Quote": {input: `a=1 b="open`, shouldErr: true},
+		"Unidentified":       {input: "a=1 \x01", shouldErr: true},
+		"Many Lines":         {input: "a=1\nb=2\n", shouldErr: true},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := Line(test.input)
+			if test.shouldErr != (err != nil) {
+				t.Fatalf("Line(%q) returned error %v; expected an error: %v", test.input, err, test.shouldErr)
+			}
+			if test.shouldErr {
+				return
+			}
+
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("Line(%q) yielded %#v; expected %#v", test.input, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestLineError(t *testing.T) {
+	_, err := Line(`msg="open`)
+
+	var lineErr *LineError
+	if !errors.As(err, &lineErr) || lineErr.Line != 1 {
+		t.Fatalf("Line() returned error %v; expected a *LineError for line 1", err)
+	}
+
+	var quoteErr *lex.UnterminatedQuoteError
+	if !errors.As(err, &quoteErr) {
+		t.Fatalf("Line() returned error %v; expected it to wrap a *lex.UnterminatedQuoteError", err)
+	}
+}
@@ -0,0 +1,59 @@
+package parse
+
+import (
+	"strings"
+	"unicode"
+)
+
+// WithListValues splits values written as a bracketed list, such as
+// tags=[a,b,c], into a []string.  elements are separated by commas and may be
+// quoted, with a backslash escaping the quote, to hold commas of their own:
+// names=["a,b",c].  white space around an element is dropped and [] is an
+// empty list.  a value with an unterminated quote is kept as it is.
+func WithListValues(lists bool) func(*Parser) error {
+	return func(p *Parser) error {
+		p.listValues = lists
+		return nil
+	}
+}
+
+// splitList returns the elements of s if it is a bracketed list.
+func splitList(s string) ([]string, bool) {
+	if len(s) < 2 || s[0] != '[' || s[len(s)-1] != ']' {
+		return nil, false
+	}
+
+	inner := s[1 : len(s)-1]
+	list := []string{}
+	if strings.TrimSpace(inner) == "" {
+		return list, true
+	}
+
+	sb := &strings.Builder{}
+	var quote rune
+	escaped := false
+	for _, r := range inner {
+		switch {
+		case escaped:
+			sb.WriteRune(r)
+			escaped = false
+		case quote != 0 && r == '\\':
+			escaped = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			sb.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ',':
+			list = append(list, strings.TrimFunc(sb.String(), unicode.IsSpace))
+			sb.Reset()
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	if quote != 0 {
+		return nil, false
+	}
+	return append(list, strings.TrimFunc(sb.String(), unicode.IsSpace)), true
+}
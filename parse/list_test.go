@@ -0,0 +1,36 @@
+package parse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestListValues(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		lists    bool
+		expected map[string]interface{}
+	}{
+		"Plain":          {input: "tags=[a,b,c]\n", lists: true, expected: map[string]interface{}{"tags": []string{"a", "b", "c"}}},
+		"Quoted":         {input: `names=["a,b","c"]` + "\n", lists: true, expected: map[string]interface{}{"names": []string{"a,b", "c"}}},
+		"Escaped Quote":  {input: `q=['it\'s',x]` + "\n", lists: true, expected: map[string]interface{}{"q": []string{"it's", "x"}}},
+		"Empty":          {input: "tags=[]\n", lists: true, expected: map[string]interface{}{"tags": []string{}}},
+		"Single":         {input: "tags=[a]\n", lists: true, expected: map[string]interface{}{"tags": []string{"a"}}},
+		"Quoted Value":   {input: `tags="[a, b]"` + "\n", lists: true, expected: map[string]interface{}{"tags": []string{"a", "b"}}},
+		"Unterminated":   {input: `tags=["a,b]` + "\n", lists: true, expected: map[string]interface{}{"tags": `["a,b]`}},
+		"Not A List":     {input: "tags=[a n=1\n", lists: true, expected: map[string]interface{}{"tags": "[a", "n": int64(1)}},
+		"Off By Default": {input: "tags=[a,b,c]\n", expected: map[string]interface{}{"tags": "[a,b,c]"}},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := parseAll(t, test.input, WithListValues(test.lists))
+			if expected := []map[string]interface{}{test.expected}; !reflect.DeepEqual(got, expected) {
+				t.Fatalf("parsing %q yielded %#v; expected %#v", test.input, got, expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package parse
+
+import (
+	"fmt"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// WithUnicodeNormalize puts keys and string values into the normalization
+// form given, so strings that look alike compare equal whether their accents
+// were written composed or decomposed.  norm.NFC, the zero form, suits most
+// uses.  values are normalized once WithURLDecode has decoded them and before
+// any other conversion.  by default strings are kept as they were written.
+func WithUnicodeNormalize(form norm.Form) func(*Parser) error {
+	return func(p *Parser) error {
+		switch form {
+		case norm.NFC, norm.NFD, norm.NFKC, norm.NFKD:
+			p.normalize = form.String
+			return nil
+		}
+		return fmt.Errorf("unknown unicode normalization form %d", form)
+	}
+}
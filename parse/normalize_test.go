@@ -0,0 +1,52 @@
+package parse
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+func TestUnicodeNormalize(t *testing.T) {
+	const (
+		composed   = "caf\u00e9"
+		decomposed = "cafe\u0301"
+	)
+	input := composed + "=1 " + decomposed + "=2 name=" + decomposed + "\n"
+
+	tests := map[string]struct {
+		opts     []func(*Parser) error
+		expected []map[string]interface{}
+	}{
+		"Off": {
+			expected: []map[string]interface{}{{composed: int64(1), decomposed: int64(2), "name": decomposed}},
+		},
+		"NFC": {
+			opts:     []func(*Parser) error{WithUnicodeNormalize(norm.NFC)},
+			expected: []map[string]interface{}{{composed: int64(2), "name": composed}},
+		},
+		"NFD": {
+			opts:     []func(*Parser) error{WithUnicodeNormalize(norm.NFD)},
+			expected: []map[string]interface{}{{decomposed: int64(2), "name": decomposed}},
+		},
+		"Both Forms Kept": {
+			opts:     []func(*Parser) error{WithUnicodeNormalize(norm.NFC), WithMultiValue(true)},
+			expected: []map[string]interface{}{{composed: []interface{}{int64(1), int64(2)}, "name": composed}},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := parseAll(t, input, test.opts...); !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("parsing %q yielded %#v; expected %#v", input, got, test.expected)
+			}
+		})
+	}
+
+	if _, err := NewParser(WithUnicodeNormalize(norm.Form(42))); err == nil {
+		t.Fatal("NewParser() accepted an unknown normalization form")
+	}
+}
@@ -1,17 +1,97 @@
 package parse
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/ayang64/ginsu/lex"
 )
 
+// UnparsedKey is the key under which WithOnUnidentified(UnidentifiedRaw)
+// stores input the lexer could not identify.
+const UnparsedKey = "_unparsed"
+
+// LineKey is the conventional key for WithLineKey.
+const LineKey = "_line"
+
+// SourceKey is the default key under which WithSource stores the name of the
+// input.
+const SourceKey = "_source"
+
+// UnidentifiedMode selects what the parser does with input the lexer could not
+// identify, such as control characters.
+type UnidentifiedMode int
+
+const (
+	// UnidentifiedSkip drops the unidentified input.
+	UnidentifiedSkip = UnidentifiedMode(iota)
+	// UnidentifiedRaw keeps the unidentified input under UnparsedKey.
+	UnidentifiedRaw
+	// UnidentifiedError abandons the line and reports a *LineError.
+	UnidentifiedError
+)
+
+// LineError is an error encountered while parsing a particular line of input.
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
 type Parser struct {
-	r   io.Reader
-	log *log.Logger
+	r              io.Reader
+	log            *log.Logger
+	level          lex.Level
+	onError        func(error)
+	multiValue     bool
+	nestedKeys     bool
+	timeFields     map[string][]string
+	durationFields map[string]bool
+	autoTimeFields map[string]bool
+	onUnidentified UnidentifiedMode
+	lineKey        string
+	lexOpts        []func(*lex.Lexer) error
+	lexer          *lex.Lexer
+	jsonInput      bool
+	recordCap      int
+	maxRecords     int
+	trimValues     bool
+	skipEmpty      bool
+	keyTransform   func(string) string
+	valueTransform func(string, interface{}) interface{}
+	positional     []string
+	reducer        Reducer
+	listValues     bool
+	boolLiterals   map[string]bool
+	allowedKeys    map[string]bool
+	urlDecodeAll   bool
+	urlFields      map[string]bool
+	onDisallowed   DisallowedMode
+	fieldLimit     int
+	truncatedKey   string
+	source         string
+	sourceKey      string
+	rawLine        bool
+	continuation   bool
+	strict         bool
+	normalize      func(string) string
+	delimiter      rune
+	stats          Stats
 }
 
 func WithReader(r io.Reader) func(*Parser) error {
@@ -28,10 +108,330 @@ func WithLogger(lggr *log.Logger) func(*Parser) error {
 	}
 }
 
+// WithLogLevel sets how much the parser, and the lexer it builds, write to the
+// logger.  the default is lex.LevelDebug, which traces every token.
+func WithLogLevel(level lex.Level) func(*Parser) error {
+	return func(p *Parser) error {
+		p.level = level
+		return nil
+	}
+}
+
+// logf writes a message to the logger if the parser logs at level.
+func (p *Parser) logf(level lex.Level, format string, args ...interface{}) {
+	if p.level >= level {
+		p.log.Printf(format, args...)
+	}
+}
+
+// WithErrorHandler sets a function to be called with each error found in the
+// input, typically a *LineError.  by default errors are logged.
+func WithErrorHandler(fn func(error)) func(*Parser) error {
+	return func(p *Parser) error {
+		p.onError = fn
+		return nil
+	}
+}
+
+// WithOnUnidentified sets how input the lexer could not identify is handled.
+// the default is UnidentifiedSkip.
+func WithOnUnidentified(mode UnidentifiedMode) func(*Parser) error {
+	return func(p *Parser) error {
+		switch mode {
+		case UnidentifiedSkip, UnidentifiedRaw, UnidentifiedError:
+			p.onUnidentified = mode
+			return nil
+		}
+		return fmt.Errorf("unknown unidentified token mode %d", mode)
+	}
+}
+
+// WithLineKey stores the number of the line each record was parsed from under
+// key, typically LineKey.  lines are numbered from one and blank lines are
+// counted even though they yield no record.
+func WithLineKey(key string) func(*Parser) error {
+	return func(p *Parser) error {
+		p.lineKey = key
+		return nil
+	}
+}
+
+// WithCommentPrefix ignores comments that start with prefix and run to the end
+// of the line.  see lex.WithCommentPrefix.
+func WithCommentPrefix(prefix string) func(*Parser) error {
+	return func(p *Parser) error {
+		p.lexOpts = append(p.lexOpts, lex.WithCommentPrefix(prefix))
+		return nil
+	}
+}
+
+// WithRecordDelimiter ends each logfmt record at r instead of at a newline.
+// with a delimiter such as '\x00', newlines are just white space and line
+// numbers count records.  see lex.WithRecordDelimiter.
+func WithRecordDelimiter(r rune) func(*Parser) error {
+	return func(p *Parser) error {
+		p.lexOpts = append(p.lexOpts, lex.WithRecordDelimiter(r))
+		p.delimiter = r
+		return nil
+	}
+}
+
+// WithNewlineInValues allows quoted values to hold literal newlines, as stack
+// traces and pretty printed JSON do.  a newline inside an open quote then
+// doesn't end the record, and line numbers still count every line of input.
+// by default a newline before the closing quote is an error.
+func WithNewlineInValues(allow bool) func(*Parser) error {
+	return func(p *Parser) error {
+		p.lexOpts = append(p.lexOpts, lex.WithMultilineQuotes(allow))
+		return nil
+	}
+}
+
+// WithTabAsSeparator reads pairs separated by tabs, so a value may hold
+// spaces without being quoted.  see lex.WithTabAsSeparator.
+func WithTabAsSeparator(tabs bool) func(*Parser) error {
+	return func(p *Parser) error {
+		p.lexOpts = append(p.lexOpts, lex.WithTabAsSeparator(tabs))
+		return nil
+	}
+}
+
+// WithRawBackslash keeps every backslash in the input, so Windows paths can't
+// be mistaken for escapes.  see lex.WithRawBackslash.
+func WithRawBackslash(raw bool) func(*Parser) error {
+	return func(p *Parser) error {
+		p.lexOpts = append(p.lexOpts, lex.WithRawBackslash(raw))
+		return nil
+	}
+}
+
+// WithQuoteRunes adds a pair of quotes, such as '[' and ']', to those that
+// quote keys and values.  see lex.WithQuoteRunes.
+func WithQuoteRunes(open, close rune) func(*Parser) error {
+	return func(p *Parser) error {
+		p.lexOpts = append(p.lexOpts, lex.WithQuoteRunes(open, close))
+		return nil
+	}
+}
+
+// WithReadTimeout ends parsing with an error when a single read of the input
+// takes longer than d.  it has no effect on JSON input.  see
+// lex.WithReadTimeout.
+func WithReadTimeout(d time.Duration) func(*Parser) error {
+	return func(p *Parser) error {
+		p.lexOpts = append(p.lexOpts, lex.WithReadTimeout(d))
+		return nil
+	}
+}
+
+// WithInterner has the lexer intern keys, so keys that repeat on every line
+// share a string rather than each being allocated.  values interns values as
+// well, which suits values with few distinct strings.  it has no effect on
+// JSON input.  see lex.WithInterner.
+func WithInterner(values bool) func(*Parser) error {
+	return func(p *Parser) error {
+		p.lexOpts = append(p.lexOpts, lex.WithInterner(values))
+		return nil
+	}
+}
+
+// WithLexerOptions configures the lexer the parser builds for its input.  see
+// the options in package lex.
+func WithLexerOptions(opts ...func(*lex.Lexer) error) func(*Parser) error {
+	return func(p *Parser) error {
+		p.lexOpts = append(p.lexOpts, opts...)
+		return nil
+	}
+}
+
+// WithLexer parses the tokens of a lexer that has already been built, rather
+// than building one.  the input is whatever l was given to read, so WithReader
+// is ignored.  other lexer options given to the parser are applied to l.
+func WithLexer(l *lex.Lexer) func(*Parser) error {
+	return func(p *Parser) error {
+		if l == nil {
+			return fmt.Errorf("lexer must not be nil")
+		}
+		p.lexer = l
+		return nil
+	}
+}
+
+// WithRecordCapacity pre-sizes each record's map for n keys.  for input with a
+// known, wide schema this saves the map growing as each line is parsed.  the
+// default of zero gives no size hint.
+func WithRecordCapacity(n int) func(*Parser) error {
+	return func(p *Parser) error {
+		if n < 0 {
+			return fmt.Errorf("record capacity must not be negative; got %d", n)
+		}
+		p.recordCap = n
+		return nil
+	}
+}
+
+// WithMaxRecords stops parsing once n non-empty records have been emitted,
+// without reading the rest of the input.  the default of zero means no limit.
+//
+// parsing returns as soon as the limit is reached, even if the reader is a live
+// stream with no more data yet.  a read that is already in progress at that
+// point may still complete afterwards.
+func WithMaxRecords(n int) func(*Parser) error {
+	return func(p *Parser) error {
+		if n < 0 {
+			return fmt.Errorf("maximum records must not be negative; got %d", n)
+		}
+		p.maxRecords = n
+		return nil
+	}
+}
+
+// errMaxRecords stops parsing when the record limit is reached.
+var errMaxRecords = errors.New("maximum records reached")
+
+// WithMultiValue controls what happens when a key appears more than once in a
+// single line.  By default the last value wins.  When enabled, the first
+// value is stored as-is and any repeat promotes it to a []interface{} holding
+// every value seen for that key, in order.
+func WithMultiValue(multi bool) func(*Parser) error {
+	return func(p *Parser) error {
+		p.multiValue = multi
+		return nil
+	}
+}
+
+// WithNestedKeys splits keys on '.' and stores values in nested maps, so
+// a.b.c=1 is stored as {"a": {"b": {"c": 1}}}.  when a path runs into a scalar
+// that was stored earlier in the line (or a scalar is stored where a map
+// already exists) the most recent value wins and the collision is logged.
+func WithNestedKeys(nested bool) func(*Parser) error {
+	return func(p *Parser) error {
+		p.nestedKeys = nested
+		return nil
+	}
+}
+
+// WithTrimValues lets a value found past white space after the separator hold
+// separators of its own, so key= http://x?y=1 stores the whole URL.  white
+// space on either side of the separator is tolerated anyway, but by default a
+// value past white space that is followed by a separator is taken to be the
+// next key, so a= b=2 leaves a with an empty value.  with WithTrimValues it
+// stores "b=2" under a.
+func WithTrimValues(trim bool) func(*Parser) error {
+	return func(p *Parser) error {
+		p.trimValues = trim
+		p.lexOpts = append(p.lexOpts, lex.WithSpacedSeparator(trim))
+		return nil
+	}
+}
+
+// WithSkipEmptyValues drops pairs whose value is empty, such as a= or a="",
+// rather than storing an empty string under their key.
+func WithSkipEmptyValues(skip bool) func(*Parser) error {
+	return func(p *Parser) error {
+		p.skipEmpty = skip
+		return nil
+	}
+}
+
+// WithSource stores name, such as the file the input is read from, in every
+// non-empty record.  it is stored under SourceKey unless WithSourceKey names
+// another key.
+func WithSource(name string) func(*Parser) error {
+	return func(p *Parser) error {
+		p.source = name
+		return nil
+	}
+}
+
+// WithSourceKey sets the key WithSource stores the name of the input under,
+// for when SourceKey collides with the data.
+func WithSourceKey(key string) func(*Parser) error {
+	return func(p *Parser) error {
+		if key == "" {
+			return fmt.Errorf("source key must not be empty")
+		}
+		p.sourceKey = key
+		return nil
+	}
+}
+
+// WithKeyTransform passes every key through fn before it is stored, such as
+// to lower case keys from producers that disagree on their case.  the other
+// options that name keys, like WithTimeField, name them as transformed.  keys
+// that transform to the same key are repeats of it: the last value wins,
+// unless WithMultiValue collects them all.
+func WithKeyTransform(fn func(string) string) func(*Parser) error {
+	return func(p *Parser) error {
+		p.keyTransform = fn
+		return nil
+	}
+}
+
+// WithValueTransform passes every value through fn before it is stored, such
+// as to redact secrets.  fn is given the value's key, as transformed by
+// WithKeyTransform, and sees the value once it is typed: numbers are int64 or
+// float64 and WithTimeField and WithDurationField values are converted.
+func WithValueTransform(fn func(key string, value interface{}) interface{}) func(*Parser) error {
+	return func(p *Parser) error {
+		p.valueTransform = fn
+		return nil
+	}
+}
+
+// WithTimeField parses the value of key as a time.Time using the first of the
+// supplied time.Parse layouts that matches.  if none match, the original
+// string is kept.  WithTimeField may be given more than once to handle several
+// keys.
+func WithTimeField(key string, layouts ...string) func(*Parser) error {
+	return func(p *Parser) error {
+		if len(layouts) == 0 {
+			return fmt.Errorf("time field %q needs at least one layout", key)
+		}
+		p.timeFields[key] = layouts
+		return nil
+	}
+}
+
+// WithDurationField parses the values of keys as a time.Duration in the form
+// time.ParseDuration takes, such as 500ms or 1.2s.  values that aren't
+// durations are kept, so a bare number stays a number.
+func WithDurationField(keys ...string) func(*Parser) error {
+	return func(p *Parser) error {
+		for _, key := range keys {
+			p.durationFields[key] = true
+		}
+		return nil
+	}
+}
+
+// WithURLDecode decodes the percent encoding of the values of keys, as web
+// servers log query strings, so q=hello%20world is stored as "hello world".
+// like url.QueryUnescape, it turns '+' into a space.  with no keys every value
+// is decoded.  a value that isn't validly encoded is kept as it is.
+func WithURLDecode(keys ...string) func(*Parser) error {
+	return func(p *Parser) error {
+		if len(keys) == 0 {
+			p.urlDecodeAll = true
+		}
+		for _, key := range keys {
+			p.urlFields[key] = true
+		}
+		return nil
+	}
+}
+
 func NewParser(opts ...func(*Parser) error) (*Parser, error) {
 	parser := Parser{
-		log: log.New(ioutil.Discard, "", 0),
-		r:   os.Stdin,
+		log:            log.New(ioutil.Discard, "", 0),
+		level:          lex.LevelDebug,
+		r:              os.Stdin,
+		timeFields:     map[string][]string{},
+		durationFields: map[string]bool{},
+		autoTimeFields: map[string]bool{},
+		urlFields:      map[string]bool{},
+		sourceKey:      SourceKey,
+		delimiter:      '\n',
 	}
 
 	for _, opt := range opts {
@@ -45,82 +445,483 @@ func NewParser(opts ...func(*Parser) error) (*Parser, error) {
 func (p *Parser) Parse() <-chan map[string]interface{} {
 	ch := make(chan map[string]interface{})
 	go func() {
-		err := p.parse(ch)
+		err := p.parse(func(m map[string]interface{}) error {
+			ch <- m
+			return nil
+		})
 		if err != nil {
-			p.log.Printf("err %v", err)
+			p.logf(lex.LevelError, "err %v", err)
 		}
 		close(ch)
 	}()
 	return ch
 }
 
-func (p *Parser) parse(ch chan map[string]interface{}) error {
-	lexer, err := lex.NewLexer(lex.WithReader(p.r), lex.WithLogger(p.log))
+// ParseFunc parses the input in the calling goroutine, calling fn with each
+// record in turn.  it yields the same records as Parse() without the cost of a
+// channel.  if fn returns an error, parsing stops and ParseFunc returns that
+// error.
+func (p *Parser) ParseFunc(fn func(map[string]interface{}) error) error {
+	return p.parse(fn)
+}
+
+func (p *Parser) newRecord() map[string]interface{} {
+	return make(map[string]interface{}, p.recordCap)
+}
+
+// store places value under key in kvp, accumulating repeated keys when
+// multi-value mode is enabled.
+func (p *Parser) store(kvp map[string]interface{}, key string, value interface{}) {
+	if p.normalize != nil {
+		key = p.normalize(key)
+	}
+	if p.keyTransform != nil {
+		key = p.keyTransform(key)
+	}
+	if !p.allowed(key) || !p.withinLimit(kvp, key) {
+		return
+	}
+
+	value = p.convert(key, value)
+	if p.valueTransform != nil {
+		value = p.valueTransform(key, value)
+	}
+
+	if p.nestedKeys {
+		kvp, key = p.descend(kvp, key)
+	}
+
+	prev, exists := kvp[key]
+	if _, isMap := prev.(map[string]interface{}); isMap && exists {
+		p.logf(lex.LevelInfo, "key %q replaces a nested map with a value", key)
+		exists = false
+	}
+
+	if !p.multiValue || !exists {
+		kvp[key] = value
+		return
+	}
+
+	if values, isSlice := prev.([]interface{}); isSlice {
+		kvp[key] = append(values, value)
+		return
+	}
+	kvp[key] = []interface{}{prev, value}
+}
+
+// convert applies any per-key value conversions that have been configured.
+func (p *Parser) convert(key string, value interface{}) interface{} {
+	if p.urlDecodeAll || p.urlFields[key] {
+		if s, isString := value.(string); isString {
+			if decoded, err := url.QueryUnescape(s); err == nil {
+				value = decoded
+			} else {
+				p.logf(lex.LevelInfo, "value %q of %q is not URL encoded: %v", s, key, err)
+			}
+		}
+	}
+
+	if s, isString := value.(string); isString && p.normalize != nil {
+		value = p.normalize(s)
+	}
+
+	if layouts, isTime := p.timeFields[key]; isTime {
+		s, isString := value.(string)
+		if !isString {
+			return value
+		}
+		for _, layout := range layouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t
+			}
+		}
+		p.logf(lex.LevelInfo, "value %q of time field %q matched none of the layouts %q", s, key, layouts)
+	}
+
+	if p.autoTimeFields[key] {
+		if t, isTime := autoTime(value); isTime {
+			return t
+		}
+		p.logf(lex.LevelInfo, "value %v of time field %q doesn't look like a time", value, key)
+	}
+
+	if p.durationFields[key] {
+		s, isString := value.(string)
+		if !isString {
+			return value
+		}
+		if d, err := time.ParseDuration(s); err == nil {
+			return d
+		}
+		p.logf(lex.LevelInfo, "value %q of duration field %q is not a duration", s, key)
+	}
+
+	if p.listValues {
+		if s, isString := value.(string); isString {
+			if list, isList := splitList(s); isList {
+				return list
+			}
+		}
+	}
+
+	if p.boolLiterals != nil {
+		if s, isString := value.(string); isString {
+			if b, isBool := p.parseBool(s); isBool {
+				return b
+			}
+		}
+	}
+	return value
+}
+
+// descend walks (creating as needed) the nested maps named by all but the last
+// component of a dotted key and returns the innermost map and the final
+// component.
+func (p *Parser) descend(kvp map[string]interface{}, key string) (map[string]interface{}, string) {
+	path := strings.Split(key, ".")
+	for _, name := range path[:len(path)-1] {
+		next, isMap := kvp[name].(map[string]interface{})
+		if !isMap {
+			if prev, exists := kvp[name]; exists {
+				p.logf(lex.LevelInfo, "key %q replaces value %v with a nested map", key, prev)
+			}
+			next = map[string]interface{}{}
+			kvp[name] = next
+		}
+		kvp = next
+	}
+	return kvp, path[len(path)-1]
+}
+
+func (p *Parser) report(err error) {
+	p.stats.Errors++
+	if p.onError == nil {
+		p.logf(lex.LevelError, "%v", err)
+		return
+	}
+	p.onError(err)
+}
+
+// guard calls fn, turning a panic into an error reported against line, such
+// as from a hook given to WithKeyTransform.  it reports whether fn returned
+// normally.  the line's record is then dropped, but the lines after it are
+// still parsed.
+func (p *Parser) guard(line int, fn func()) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			p.report(&LineError{Line: line, Err: fmt.Errorf("panic: %v", r)})
+			ok = false
+		}
+	}()
+	fn()
+	return true
+}
+
+// tokenString returns the value of tok, which should be a string, as one.
+func tokenString(tok lex.Token) string {
+	if s, isString := tok.Value.(string); isString {
+		return s
+	}
+	return fmt.Sprint(tok.Value)
+}
+
+// stashUnparsed appends unidentified input to the record's UnparsedKey.
+func (p *Parser) stashUnparsed(kvp map[string]interface{}, raw interface{}) {
+	if prev, exists := kvp[UnparsedKey]; exists {
+		kvp[UnparsedKey] = fmt.Sprintf("%v %v", prev, raw)
+		return
+	}
+	kvp[UnparsedKey] = raw
+}
+
+func (p *Parser) parse(emit func(map[string]interface{}) error) error {
+	counted := emit
+	emit = func(m map[string]interface{}) error {
+		if len(m) > 0 {
+			p.stats.Records++
+			if p.source != "" {
+				m[p.sourceKey] = p.source
+			}
+		} else {
+			p.stats.Empty++
+		}
+		return counted(m)
+	}
+
+	if p.maxRecords > 0 {
+		emitted, next := 0, emit
+		emit = func(m map[string]interface{}) error {
+			if err := next(m); err != nil {
+				return err
+			}
+			if len(m) > 0 {
+				if emitted++; emitted >= p.maxRecords {
+					return errMaxRecords
+				}
+			}
+			return nil
+		}
+	}
+
+	err := p.parseInput(emit)
+	if err == errMaxRecords {
+		return nil
+	}
+	return err
+}
+
+// newLexer returns the lexer for the input, building one unless it was
+// supplied with WithLexer.
+func (p *Parser) newLexer(r io.Reader) (*lex.Lexer, error) {
+	if p.lexer == nil {
+		return lex.NewLexer(append([]func(*lex.Lexer) error{lex.WithReader(r), lex.WithLogger(p.log), lex.WithLogLevel(p.level)}, p.lexOpts...)...)
+	}
+
+	for _, opt := range p.lexOpts {
+		if err := opt(p.lexer); err != nil {
+			return nil, err
+		}
+	}
+	return p.lexer, nil
+}
+
+func (p *Parser) parseInput(emit func(map[string]interface{}) error) error {
+	if p.jsonInput {
+		return p.parseJSON(emit)
+	}
+
+	// raw records the input for WithRawLine.
+	var raw *rawRecorder
+	r := p.r
+	if (p.rawLine || p.continuation) && p.lexer == nil {
+		raw = newRawRecorder(r, p.delimiter)
+		r = raw
+	}
+
+	lexer, err := p.newLexer(r)
 	if err != nil {
 		return err
 	}
 
-	tokens := []lex.Token{}
-
-	kvp := map[string]interface{}{}
-	for tok := range lexer.Lex() {
-		if tok.Type == lex.TokenWhiteSpace {
-			continue // skip white space and unknown tokens.
-		}
-
-		tokens = append(tokens, tok)
-		p.log.Printf("tokens: %v", tokens)
-
-		// look at the last three tokens
-		if len(tokens) >= 3 {
-			cur := tokens[len(tokens)-3:]
-			p.log.Printf(">>> TOP THREE TOKENS: %v", cur)
-			// basically this is:
-			//
-			// kvp := ATOM '=' value
-			// 				;
-			//
-			// value := QSTRING | ATOM
-			//					;
-			//
-			// but way uglier.
-			//
-			if cur[0].Type == lex.TokenAtom && cur[1].Type == lex.TokenEqual && cur[2].Type == lex.TokenAtom {
-				kvp[cur[0].Value.(string)] = cur[2].Value
-				// shift token slice
-				p.log.Printf("reducing tokens after parsing a key/value pair")
-				p.log.Printf("kvp is now %#v", kvp)
-				tokens = tokens[:0]
-				continue
+	// stop the lexer if we return before it reaches the end of the input.  we
+	// don't wait for it: it may be blocked reading a live stream, and it stops
+	// on its own once that read returns.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tokens := lexer.LexContext(ctx)
+
+	// line is the number of the line being parsed.  aborted is set when the
+	// rest of the line should be ignored and its record dropped.
+	line := 1
+	aborted := false
+
+	// spanned counts the delimiters inside the line's quoted strings, which
+	// make it span that many more lines of input.
+	spanned := 0
+
+	// pending is set once the line has any tokens other than a comment, so
+	// that it can be ended when the input ends.
+	pending := false
+
+	// unparsed holds the line's unidentified input for UnidentifiedRaw until
+	// its record is done.
+	var unparsed []interface{}
+
+	// priority holds the line's syslog priority, if it has one, until its
+	// record is done.
+	var priority *int64
+
+	// held is the latest record, kept back for WithContinuation until the
+	// line after it is known not to continue it.  starting is set until the
+	// first token of a line has been fed, and continued once that token
+	// makes the line a continuation.
+	var held map[string]interface{}
+	starting, continued := true, false
+	release := func() error {
+		if held == nil {
+			return nil
+		}
+		kvp := held
+		held = nil
+		return emit(kvp)
+	}
+
+	reducer := p.reducer
+	switch {
+	case reducer != nil:
+	case p.positional != nil:
+		reducer = newFields(p, &line)
+	default:
+		reducer = newLogfmt(p, &line)
+	}
+
+	// finish emits a record the reducer is done with.  text is the line it
+	// came from, for WithRawLine, when the record ended with the line.
+	finish := func(kvp map[string]interface{}, text string, end bool) error {
+		if kvp == nil {
+			p.stats.Skipped++
+			return nil
+		}
+		for _, raw := range unparsed {
+			p.stashUnparsed(kvp, raw)
+		}
+		unparsed = nil
+
+		if priority != nil {
+			p.storePriority(kvp, *priority)
+			priority = nil
+		}
+
+		if p.lineKey != "" && len(kvp) > 0 {
+			kvp[p.lineKey] = line
+		}
+		if p.rawLine && raw != nil && end && len(kvp) > 0 {
+			kvp[RawKey] = text
+		}
+		p.logf(lex.LevelDebug, "SENDING KVP TO CALLER: %#v", kvp)
+
+		if p.continuation {
+			if err := release(); err != nil {
+				return err
+			}
+			if len(kvp) > 0 {
+				held = kvp
+				return nil
+			}
+		}
+		return emit(kvp)
+	}
+
+	// nextLine readies the parser for the line after the one just ended.
+	nextLine := func() {
+		aborted, pending, unparsed, priority = false, false, nil, nil
+		starting, continued = true, false
+		line += 1 + spanned
+		spanned = 0
+	}
+
+	// feed deals with a single token of the line.
+	feed := func(tok lex.Token) error {
+		if starting && held != nil {
+			// only a line read through raw can have its text appended.
+			if raw != nil && tok.Type == lex.TokenWhiteSpace {
+				continued = true
+			} else if err := release(); err != nil {
+				return err
 			}
 		}
-		if len(tokens) > 0 {
-			cur := tokens[len(tokens)-1:]
-			if curType := cur[0].Type; curType == lex.TokenNewLine || curType == lex.TokenError {
-				// we've reached the end of the line
-				p.log.Printf("SENDING KVP TO CALLER: %#v", kvp)
-				ch <- kvp
-				kvp = map[string]interface{}{}
-				p.log.Printf("reducing tokens after parsing a newline")
-				tokens = tokens[:len(tokens)-1]
-
-				if curType == lex.TokenError {
-					break
-				}
-				continue
+		starting = false
+
+		switch tok.Type {
+		case lex.TokenComment:
+			return nil
+		case lex.TokenNewLine, lex.TokenEOF:
+		default:
+			pending = true
+		}
+
+		if continued {
+			// a continuation line is kept as it was written, so even its
+			// errors are left alone.
+			if tok.Type == lex.TokenQuotedString {
+				spanned += strings.Count(tokenString(tok), string(p.delimiter))
+			}
+			if tok.Type == lex.TokenNewLine || tok.Type == lex.TokenEOF {
+				p.stats.Lines += 1 + spanned
+				p.continueRecord(held, raw.take(1+spanned))
+				nextLine()
+			}
+			return nil
+		}
+
+		if tok.Type == lex.TokenError {
+			// the lexer couldn't make sense of this line so its record
+			// can't be trusted.
+			err, _ := tok.Value.(error)
+			p.report(&LineError{Line: line, Err: err})
+			aborted = true
+			return nil
+		}
+
+		if tok.Type == lex.TokenQuotedString {
+			spanned += strings.Count(tokenString(tok), string(p.delimiter))
+		}
+
+		end := tok.Type == lex.TokenNewLine || tok.Type == lex.TokenEOF
+		if aborted && !end {
+			return nil
+		}
+
+		if tok.Type == lex.TokenPriority {
+			pri, _ := tok.Value.(int64)
+			priority = &pri
+			return nil
+		}
+
+		if tok.Type == lex.TokenUnidentified {
+			switch {
+			case p.strict || p.onUnidentified == UnidentifiedError:
+				p.report(&LineError{Line: line, Err: fmt.Errorf("unidentified input %q", tok.Value)})
+				aborted = true
+			case p.onUnidentified == UnidentifiedRaw:
+				unparsed = append(unparsed, tok.Value)
 			}
+			return nil
+		}
 
+		// the end of the line is fed even to a line that was dropped, so the
+		// reducer starts the next line afresh.
+		var kvp map[string]interface{}
+		var done bool
+		if !p.guard(line, func() { kvp, done = reducer.Feed(tok) }) {
+			aborted = true
 		}
 
-		// if we're here, we should probably shift the tokens by 2
-		shift := func() int {
-			if len(tokens) > 2 {
-				return 2
+		if !end {
+			if done && !aborted {
+				return finish(kvp, "", false)
 			}
-			return 0
+			return nil
 		}
 
-		tokens = tokens[len(tokens)-shift():]
+		// we've reached the end of the line
+		p.stats.Lines += 1 + spanned
+
+		// the line's text is taken even if the line is dropped, so the
+		// next line's text starts in the right place.
+		var text string
+		if raw != nil {
+			text = raw.take(1 + spanned)
+		}
+
+		var err error
+		switch {
+		case aborted:
+			p.stats.Skipped++
+		case done:
+			err = finish(kvp, text, true)
+		}
+
+		nextLine()
+		return err
+	}
+
+	for tok := range tokens {
+		if tok.Type == lex.TokenEOF {
+			continue
+		}
+		if err := feed(tok); err != nil {
+			return err
+		}
+	}
+
+	// the last line may not have ended with a delimiter, and the lexer stops
+	// without a TokenEOF after an error it can't recover from.  either way
+	// the line ends with the input.
+	if pending {
+		if err := feed(lex.Token{Type: lex.TokenEOF}); err != nil {
+			return err
+		}
 	}
-	return nil
+	return release()
 }
@@ -0,0 +1,1152 @@
+package parse
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ayang64/ginsu/lex"
+)
+
+func parseAll(t *testing.T, input string, opts ...func(*Parser) error) []map[string]interface{} {
+	t.Helper()
+
+	p, err := NewParser(append([]func(*Parser) error{WithReader(strings.NewReader(input))}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := []map[string]interface{}{}
+	for m := range p.Parse() {
+		records = append(records, m)
+	}
+	return records
+}
+
+func TestMultiValue(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		multi    bool
+		expected []map[string]interface{}
+	}{
+		"Repeated Key": {
+			input:    "tag=a tag=b tag=c\n",
+			multi:    true,
+			expected: []map[string]interface{}{{"tag": []interface{}{"a", "b", "c"}}},
+		},
+		"Single Keys Stay Scalar": {
+			input:    "tag=a other=b\n",
+			multi:    true,
+			expected: []map[string]interface{}{{"tag": "a", "other": "b"}},
+		},
+		"Last Wins By Default": {
+			input:    "tag=a tag=b tag=c\n",
+			expected: []map[string]interface{}{{"tag": "c"}},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := parseAll(t, test.input, WithMultiValue(test.multi))
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("parsing %q yielded %#v; expected %#v", test.input, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestNestedKeys(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		expected []map[string]interface{}
+	}{
+		"Siblings": {
+			input:    "a.b.c=1 a.b.d=2\n",
+			expected: []map[string]interface{}{{"a": map[string]interface{}{"b": map[string]interface{}{"c": int64(1), "d": int64(2)}}}},
+		},
+		"Flat Key": {
+			input:    "a=1\n",
+			expected: []map[string]interface{}{{"a": int64(1)}},
+		},
+		"Map Replaces Scalar": {
+			input:    "a=1 a.b=2\n",
+			expected: []map[string]interface{}{{"a": map[string]interface{}{"b": int64(2)}}},
+		},
+		"Scalar Replaces Map": {
+			input:    "a.b=2 a=1\n",
+			expected: []map[string]interface{}{{"a": int64(1)}},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := parseAll(t, test.input, WithNestedKeys(true))
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("parsing %q yielded %#v; expected %#v", test.input, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestTimeField(t *testing.T) {
+	const clf = "02/Jan/2006:15:04:05 -0700"
+
+	tests := map[string]struct {
+		input    string
+		key      string
+		layouts  []string
+		expected interface{}
+	}{
+		"RFC3339": {
+			input:    "ts=2023-01-02T15:04:05Z\n",
+			key:      "ts",
+			layouts:  []string{time.RFC3339},
+			expected: time.Date(2023, time.January, 2, 15, 4, 5, 0, time.UTC),
+		},
+		"Custom Layout": {
+			input:    `time="02/Jan/2023:15:04:05 +0000"` + "\n",
+			key:      "time",
+			layouts:  []string{time.RFC3339, clf},
+			expected: time.Date(2023, time.January, 2, 15, 4, 5, 0, time.FixedZone("", 0)),
+		},
+		"No Layout Matches": {
+			input:    "ts=yesterday\n",
+			key:      "ts",
+			layouts:  []string{time.RFC3339},
+			expected: "yesterday",
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := parseAll(t, test.input, WithTimeField(test.key, test.layouts...))
+			if len(got) != 1 {
+				t.Fatalf("parsing %q yielded %d records; expected 1", test.input, len(got))
+			}
+
+			value := got[0][test.key]
+			if expected, isTime := test.expected.(time.Time); isTime {
+				if tm, ok := value.(time.Time); !ok || !tm.Equal(expected) {
+					t.Fatalf("%q was parsed as %#v; expected %v", test.key, value, expected)
+				}
+				return
+			}
+
+			if value != test.expected {
+				t.Fatalf("%q was parsed as %#v; expected %#v", test.key, value, test.expected)
+			}
+		})
+	}
+}
+
+func TestAutoTimeField(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		expected interface{}
+	}{
+		"RFC3339":       {input: "ts=2020-03-01T12:30:00Z\n", expected: time.Date(2020, 3, 1, 12, 30, 0, 0, time.UTC)},
+		"RFC3339 Nano":  {input: "ts=2020-03-01T12:30:00.123456789Z\n", expected: time.Date(2020, 3, 1, 12, 30, 0, 123456789, time.UTC)},
+		"Common Log":    {input: "ts=\"01/Mar/2020:12:30:00 +0000\"\n", expected: time.Date(2020, 3, 1, 12, 30, 0, 0, time.FixedZone("", 0))},
+		"Epoch Seconds": {input: "ts=1583065800\n", expected: time.Date(2020, 3, 1, 12, 30, 0, 0, time.UTC)},
+		"Epoch Millis":  {input: "ts=1583065800250\n", expected: time.Date(2020, 3, 1, 12, 30, 0, 250*int(time.Millisecond), time.UTC)},
+		"Small Integer": {input: "ts=42\n", expected: int64(42)},
+		"Not A Time":    {input: "ts=soon\n", expected: "soon"},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := parseAll(t, test.input+"other=1583065800\n", WithAutoTimeField("ts"))
+			if len(got) != 2 {
+				t.Fatalf("parsing %q yielded %#v; expected 2 records", test.input, got)
+			}
+
+			if expected, isTime := test.expected.(time.Time); isTime {
+				if ts, ok := got[0]["ts"].(time.Time); !ok || !ts.Equal(expected) {
+					t.Fatalf("parsing %q yielded ts %#v; expected %v", test.input, got[0]["ts"], expected)
+				}
+			} else if !reflect.DeepEqual(got[0]["ts"], test.expected) {
+				t.Fatalf("parsing %q yielded ts %#v; expected %#v", test.input, got[0]["ts"], test.expected)
+			}
+
+			if other := got[1]["other"]; other != int64(1583065800) {
+				t.Fatalf("a field that isn't a time field yielded %#v; expected it untouched", other)
+			}
+		})
+	}
+}
+
+func TestSeparatorInValue(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		expected []map[string]interface{}
+	}{
+		"Padding": {input: "key=YWJj== next=1\n", expected: []map[string]interface{}{{"key": "YWJj==", "next": int64(1)}}},
+		"URL":     {input: "url=http://h/p?a=1&b=2 next=1\n", expected: []map[string]interface{}{{"url": "http://h/p?a=1&b=2", "next": int64(1)}}},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := parseAll(t, test.input); !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("parsing %q yielded %#v; expected %#v", test.input, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestBacktickValue(t *testing.T) {
+	got := parseAll(t, "cmd=`echo \"hi\"` ok=1\n")
+	if expected := []map[string]interface{}{{"cmd": `echo "hi"`, "ok": int64(1)}}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("parsing yielded %#v; expected %#v", got, expected)
+	}
+}
+
+func TestOnUnidentified(t *testing.T) {
+	const input = "a=1 \x00 b=2\nc=3\n"
+
+	tests := map[string]struct {
+		input    string
+		mode     UnidentifiedMode
+		expected []map[string]interface{}
+		errors   int
+	}{
+		"Skip": {
+			input:    input,
+			mode:     UnidentifiedSkip,
+			expected: []map[string]interface{}{{"a": int64(1), "b": int64(2)}, {"c": int64(3)}},
+		},
+		"Raw": {
+			input:    input,
+			mode:     UnidentifiedRaw,
+			expected: []map[string]interface{}{{"a": int64(1), "b": int64(2), UnparsedKey: "\x00"}, {"c": int64(3)}},
+		},
+		"Error": {
+			input:    input,
+			mode:     UnidentifiedError,
+			expected: []map[string]interface{}{{"c": int64(3)}},
+			errors:   1,
+		},
+		"Error In Value": {
+			input:    "a=\x01 b=2\nc=3\n",
+			mode:     UnidentifiedError,
+			expected: []map[string]interface{}{{"c": int64(3)}},
+			errors:   1,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var errs []error
+			got := parseAll(t, test.input, WithOnUnidentified(test.mode), WithErrorHandler(func(err error) { errs = append(errs, err) }))
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("parsing %q yielded %#v; expected %#v", test.input, got, test.expected)
+			}
+
+			if len(errs) != test.errors {
+				t.Fatalf("parsing reported %v; expected %d errors", errs, test.errors)
+			}
+
+			for _, err := range errs {
+				var lineErr *LineError
+				if !errors.As(err, &lineErr) || lineErr.Line != 1 {
+					t.Fatalf("error %v is not a *LineError for line 1", err)
+				}
+			}
+		})
+	}
+}
+
+func TestParseFunc(t *testing.T) {
+	const input = "n=1\nn=2\nn=3\nn=4\n"
+
+	p, err := NewParser(WithReader(strings.NewReader(input)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stop := errors.New("stop")
+
+	got := []map[string]interface{}{}
+	err = p.ParseFunc(func(m map[string]interface{}) error {
+		got = append(got, m)
+		if len(got) == 2 {
+			return stop
+		}
+		return nil
+	})
+
+	if err != stop {
+		t.Fatalf("ParseFunc() returned %v; expected the callback's error", err)
+	}
+
+	if expected := parseAll(t, input)[:2]; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("ParseFunc() yielded %#v; expected %#v", got, expected)
+	}
+}
+
+func TestNoTrailingNewline(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		opts     []func(*Parser) error
+		expected []map[string]interface{}
+		stats    Stats
+	}{
+		"Last Pair": {
+			input:    "a=1\nb=2",
+			expected: []map[string]interface{}{{"a": int64(1)}, {"b": int64(2)}},
+			stats:    Stats{Lines: 2, Records: 2},
+		},
+		"Trailing White Space": {
+			input:    "a=1\nb=2 ",
+			expected: []map[string]interface{}{{"a": int64(1)}, {"b": int64(2)}},
+			stats:    Stats{Lines: 2, Records: 2},
+		},
+		"Lexing Stopped": {
+			input:    "a=1\nb=toolong",
+			opts:     []func(*Parser) error{WithLexerOptions(lex.WithMaxTokenLength(4))},
+			expected: []map[string]interface{}{{"a": int64(1)}},
+			stats:    Stats{Lines: 2, Records: 1, Skipped: 1, Errors: 1},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			opts := append([]func(*Parser) error{WithReader(strings.NewReader(test.input)), WithErrorHandler(func(error) {})}, test.opts...)
+			p, err := NewParser(opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := []map[string]interface{}{}
+			if err := p.ParseFunc(func(m map[string]interface{}) error {
+				got = append(got, m)
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("parsing %q yielded %#v; expected %#v", test.input, got, test.expected)
+			}
+			if stats := p.Stats(); stats != test.stats {
+				t.Fatalf("parsing %q yielded stats %+v; expected %+v", test.input, stats, test.stats)
+			}
+		})
+	}
+}
+
+func TestLogLevel(t *testing.T) {
+	const input = "bare a=1\n"
+
+	tests := map[string]struct {
+		level lex.Level
+		info  bool
+		debug bool
+	}{
+		"Error": {level: lex.LevelError},
+		"Info":  {level: lex.LevelInfo, info: true},
+		"Debug": {level: lex.LevelDebug, info: true, debug: true},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			sb := &strings.Builder{}
+			parseAll(t, input, WithLogger(log.New(sb, "", 0)), WithLogLevel(test.level))
+
+			// the lexer and the parser both trace at debug level.
+			logged := sb.String()
+			if info := strings.Contains(logged, `key "bare" has no value`); info != test.info {
+				t.Fatalf("logged %q; expected info messages: %v", logged, test.info)
+			}
+			for _, trace := range []string{"PEEKED AT", "state KEY"} {
+				if debug := strings.Contains(logged, trace); debug != test.debug {
+					t.Fatalf("logged %q; expected debug messages like %q: %v", logged, trace, test.debug)
+				}
+			}
+		})
+	}
+}
+
+func TestLineKey(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		expected []int
+	}{
+		"Consecutive":  {input: "a=1\nb=2\nc=3\n", expected: []int{1, 2, 3}},
+		"Blank Lines":  {input: "a=1\n\nb=2\n\n\nc=3\n", expected: []int{1, 3, 6}},
+		"Unterminated": {input: "a=1\nb=2", expected: []int{1, 2}},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := []int{}
+			for _, m := range parseAll(t, test.input, WithLineKey(LineKey)) {
+				if len(m) > 0 {
+					got = append(got, m[LineKey].(int))
+				}
+			}
+
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("parsing %q numbered records %v; expected %v", test.input, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestComments(t *testing.T) {
+	const input = "# header\na=1 # set a\nb=2\n#"
+
+	got := parseAll(t, input, WithCommentPrefix("#"))
+	expected := []map[string]interface{}{{}, {"a": int64(1)}, {"b": int64(2)}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("parsing %q yielded %#v; expected %#v", input, got, expected)
+	}
+}
+
+func TestMalformedPairs(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		expected map[string]interface{}
+	}{
+		"Leading Separator": {input: "=bad good=ok\n", expected: map[string]interface{}{"good": "ok"}},
+		"Lone Separator":    {input: "a=1 = b=2\n", expected: map[string]interface{}{"a": int64(1), "b": int64(2)}},
+		"Doubled Separator": {input: "key==value next=1\n", expected: map[string]interface{}{"key": "=value", "next": int64(1)}},
+		"Bare Key":          {input: "bare a=1\n", expected: map[string]interface{}{"a": int64(1)}},
+		"Numeric Key":       {input: "1=2 c=3\n", expected: map[string]interface{}{"c": int64(3)}},
+		"Trailing Garbage":  {input: `a="x"y b=2` + "\n", expected: map[string]interface{}{"a": "x", "b": int64(2)}},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := parseAll(t, test.input)
+			if expected := []map[string]interface{}{test.expected}; !reflect.DeepEqual(got, expected) {
+				t.Fatalf("parsing %q yielded %#v; expected %#v", test.input, got, expected)
+			}
+		})
+	}
+}
+
+func TestSpacedPairs(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		expected map[string]interface{}
+	}{
+		"Spaces":           {input: "key   =   value\n", expected: map[string]interface{}{"key": "value"}},
+		"Tabs":             {input: "key\t=\t\t42 n=1\n", expected: map[string]interface{}{"key": int64(42), "n": int64(1)}},
+		"Before Only":      {input: "key   =value\n", expected: map[string]interface{}{"key": "value"}},
+		"After Only":       {input: "key=   \"a b\"\n", expected: map[string]interface{}{"key": "a b"}},
+		"End Of Input":     {input: "key = value", expected: map[string]interface{}{"key": "value"}},
+		"Bare Key":         {input: "bare   a = 1\n", expected: map[string]interface{}{"a": int64(1)}},
+		"Next Key":         {input: "a=   b=2\n", expected: map[string]interface{}{"a": "", "b": int64(2)}},
+		"Numeric Next Key": {input: "a= 1=2 c=3\n", expected: map[string]interface{}{"a": "", "c": int64(3)}},
+		"Trailing Garbage": {input: "a= \"x\"y b=2\n", expected: map[string]interface{}{"b": int64(2)}},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := parseAll(t, test.input)
+			if expected := []map[string]interface{}{test.expected}; !reflect.DeepEqual(got, expected) {
+				t.Fatalf("parsing %q yielded %#v; expected %#v", test.input, got, expected)
+			}
+		})
+	}
+}
+
+func TestEmptyValues(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		skip     bool
+		expected map[string]interface{}
+	}{
+		"Next Pair":           {input: "a= b=2\n", expected: map[string]interface{}{"a": "", "b": int64(2)}},
+		"Next Pair Skipped":   {input: "a= b=2\n", skip: true, expected: map[string]interface{}{"b": int64(2)}},
+		"End Of Line":         {input: "b=2 a=\n", expected: map[string]interface{}{"a": "", "b": int64(2)}},
+		"End Of Line Skipped": {input: "b=2 a=\n", skip: true, expected: map[string]interface{}{"b": int64(2)}},
+		"End Of Input":        {input: "a=", expected: map[string]interface{}{"a": ""}},
+		"Trailing Space":      {input: "a= \n", expected: map[string]interface{}{"a": ""}},
+		"Quoted":              {input: `a="" b=2` + "\n", expected: map[string]interface{}{"a": "", "b": int64(2)}},
+		"Quoted Skipped":      {input: `a="" b=2` + "\n", skip: true, expected: map[string]interface{}{"b": int64(2)}},
+		"Bare Key":            {input: "a b=2\n", expected: map[string]interface{}{"b": int64(2)}},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := parseAll(t, test.input, WithSkipEmptyValues(test.skip))
+			if expected := []map[string]interface{}{test.expected}; !reflect.DeepEqual(got, expected) {
+				t.Fatalf("parsing %q yielded %#v; expected %#v", test.input, got, expected)
+			}
+		})
+	}
+}
+
+func TestRecordCapacity(t *testing.T) {
+	got := parseAll(t, "a=1 b=2\n", WithRecordCapacity(30))
+	if expected := []map[string]interface{}{{"a": int64(1), "b": int64(2)}}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("parsing yielded %#v; expected %#v", got, expected)
+	}
+
+	if _, err := NewParser(WithRecordCapacity(-1)); err == nil {
+		t.Fatal("NewParser() accepted a negative record capacity")
+	}
+}
+
+func BenchmarkRecordCapacity(b *testing.B) {
+	fields := make([]string, 30)
+	for i := range fields {
+		fields[i] = fmt.Sprintf("field%02d=value%02d", i, i)
+	}
+	input := strings.Repeat(strings.Join(fields, " ")+"\n", 100)
+
+	for _, capacity := range []int{0, 30} {
+		capacity := capacity
+		b.Run(fmt.Sprintf("Capacity %d", capacity), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				p, err := NewParser(WithReader(strings.NewReader(input)), WithRecordCapacity(capacity))
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := p.ParseFunc(func(map[string]interface{}) error { return nil }); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestInterner(t *testing.T) {
+	input := "level=info msg=\"a b\" n=1\nlevel=info msg=c n=2.5\n\"level\"=warn msg= ok\nlevel=info msg=\"a b\" n=1\n"
+	expected := parseAll(t, input)
+
+	for name, values := range map[string]bool{"Keys": false, "Values": true} {
+		values := values
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := parseAll(t, input, WithInterner(values)); !reflect.DeepEqual(got, expected) {
+				t.Fatalf("parsing with an interner yielded %#v; expected %#v", got, expected)
+			}
+		})
+	}
+}
+
+func BenchmarkInterner(b *testing.B) {
+	line := "ts=2021-03-04T05:06:07Z level=info msg=request method=GET status=200 path=/index.html user=alice\n"
+	input := strings.Repeat(line, 1000)
+
+	benchmarks := map[string][]func(*Parser) error{
+		"None":   nil,
+		"Keys":   {WithInterner(false)},
+		"Values": {WithInterner(true)},
+	}
+
+	for name, opts := range benchmarks {
+		opts := opts
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				p, err := NewParser(append([]func(*Parser) error{WithReader(strings.NewReader(input))}, opts...)...)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := p.ParseFunc(func(map[string]interface{}) error { return nil }); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestUnterminatedQuotes(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		expected []map[string]interface{}
+		lines    []int
+	}{
+		"At EOF": {
+			input:    "a=1\nb=\"oops",
+			expected: []map[string]interface{}{{"a": int64(1)}},
+			lines:    []int{2},
+		},
+		"At Newline": {
+			input:    "a=\"oops\nb=2\n",
+			expected: []map[string]interface{}{{"b": int64(2)}},
+			lines:    []int{1},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			lines := []int{}
+			got := parseAll(t, test.input, WithErrorHandler(func(err error) {
+				var lineErr *LineError
+				var quoteErr *lex.UnterminatedQuoteError
+				if errors.As(err, &lineErr) && errors.As(err, &quoteErr) {
+					lines = append(lines, lineErr.Line)
+				}
+			}))
+
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("parsing %q yielded %#v; expected %#v", test.input, got, test.expected)
+			}
+			if !reflect.DeepEqual(lines, test.lines) {
+				t.Fatalf("parsing %q reported unterminated quotes on lines %v; expected %v", test.input, lines, test.lines)
+			}
+		})
+	}
+}
+
+// countingReader counts the bytes read through it.  reads are counted under a
+// lock since the lexer may still be reading when parsing returns.
+type countingReader struct {
+	r  io.Reader
+	mu sync.Mutex
+	n  int
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.mu.Lock()
+	c.n += n
+	c.mu.Unlock()
+	return n, err
+}
+
+func (c *countingReader) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.n
+}
+
+func TestMaxRecords(t *testing.T) {
+	sb := &strings.Builder{}
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(sb, "n=%d msg=\"some padding so the input spans many reads\"\n", i)
+	}
+	r := &countingReader{r: strings.NewReader(sb.String())}
+
+	p, err := NewParser(WithReader(r), WithMaxRecords(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []map[string]interface{}{}
+	for m := range p.Parse() {
+		got = append(got, m)
+	}
+
+	if len(got) != 5 {
+		t.Fatalf("parsing yielded %d records; expected 5", len(got))
+	}
+	if last := got[4]["n"]; last != int64(4) {
+		t.Fatalf("the last record was n=%v; expected n=4", last)
+	}
+
+	if r.count() == sb.Len() {
+		t.Fatal("the whole input was read despite the record limit")
+	}
+}
+
+// TestLiveStream checks that parsing returns early from a reader that stays
+// open with no more data, rather than waiting for a read that never returns.
+func TestLiveStream(t *testing.T) {
+	errStop := errors.New("stop")
+
+	tests := map[string]struct {
+		opts []func(*Parser) error
+		fn   func(map[string]interface{}) error
+		err  error
+	}{
+		"Max Records": {
+			opts: []func(*Parser) error{WithMaxRecords(1)},
+			fn:   func(map[string]interface{}) error { return nil },
+		},
+		"Callback Error": {
+			fn:  func(map[string]interface{}) error { return errStop },
+			err: errStop,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			pr, pw := io.Pipe()
+			defer pw.Close()
+			go pw.Write([]byte("a=1\n"))
+
+			p, err := NewParser(append([]func(*Parser) error{WithReader(pr)}, test.opts...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			done := make(chan error, 1)
+			go func() { done <- p.ParseFunc(test.fn) }()
+
+			select {
+			case err := <-done:
+				if err != test.err {
+					t.Fatalf("parsing returned %v; expected %v", err, test.err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("parsing didn't return while the stream was still open")
+			}
+		})
+	}
+}
+
+func TestLexerOptions(t *testing.T) {
+	const input = "a:1 url:http://host:8080/ b=2\n"
+	expected := []map[string]interface{}{{"a": int64(1), "url": "http://host:8080/"}}
+
+	t.Run("Options", func(t *testing.T) {
+		t.Parallel()
+
+		got := parseAll(t, input, WithLexerOptions(lex.WithSeparator(':')))
+		if !reflect.DeepEqual(got, expected) {
+			t.Fatalf("parsing %q yielded %#v; expected %#v", input, got, expected)
+		}
+	})
+
+	t.Run("Lexer", func(t *testing.T) {
+		t.Parallel()
+
+		l, err := lex.NewLexer(lex.WithReader(strings.NewReader(input)), lex.WithSeparator(':'))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the input comes from the lexer rather than the parser's reader.
+		got := parseAll(t, "ignored=1\n", WithLexer(l))
+		if !reflect.DeepEqual(got, expected) {
+			t.Fatalf("parsing %q yielded %#v; expected %#v", input, got, expected)
+		}
+	})
+}
+
+func TestRecordDelimiter(t *testing.T) {
+	const input = "a=1 b=2\x00msg=\"two\nlines\" c=3\nd=4\x00"
+
+	got := parseAll(t, input, WithRecordDelimiter('\x00'))
+	expected := []map[string]interface{}{
+		{"a": int64(1), "b": int64(2)},
+		{"msg": "two\nlines", "c": int64(3), "d": int64(4)},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("parsing %q yielded %#v; expected %#v", input, got, expected)
+	}
+}
+
+func TestQuotedKeys(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		expected map[string]interface{}
+	}{
+		"Quoted Key And Value": {input: `"full name"="Jane Doe"` + "\n", expected: map[string]interface{}{"full name": "Jane Doe"}},
+		"Single Quoted Key":    {input: `'request id'=abc123` + "\n", expected: map[string]interface{}{"request id": "abc123"}},
+		"Empty Key Dropped":    {input: `""=x a=1` + "\n", expected: map[string]interface{}{"a": int64(1)}},
+		"Quoted Number Value":  {input: `a="1"` + "\n", expected: map[string]interface{}{"a": "1"}},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := parseAll(t, test.input)
+			if expected := []map[string]interface{}{test.expected}; !reflect.DeepEqual(got, expected) {
+				t.Fatalf("parsing %q yielded %#v; expected %#v", test.input, got, expected)
+			}
+		})
+	}
+}
+
+func TestTrimValues(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		trim     bool
+		expected map[string]interface{}
+	}{
+		"Spaced Separator":    {input: "key = value\n", trim: true, expected: map[string]interface{}{"key": "value"}},
+		"Space Before":        {input: "key =value n=1\n", trim: true, expected: map[string]interface{}{"key": "value", "n": int64(1)}},
+		"Space After":         {input: "key= 42 n=1\n", trim: true, expected: map[string]interface{}{"key": int64(42), "n": int64(1)}},
+		"Quoted Value":        {input: "msg = \"a b\"\n", trim: true, expected: map[string]interface{}{"msg": "a b"}},
+		"Bare Key":            {input: "bare a = 1\n", trim: true, expected: map[string]interface{}{"a": int64(1)}},
+		"Separator In Value":  {input: "a = http://x?y=1\n", trim: true, expected: map[string]interface{}{"a": "http://x?y=1"}},
+		"Empty Value":         {input: "a= b=2\n", trim: true, expected: map[string]interface{}{"a": "b=2"}},
+		"Empty Value Without": {input: "a= b=2\n", expected: map[string]interface{}{"a": "", "b": int64(2)}},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := parseAll(t, test.input, WithTrimValues(test.trim))
+			if expected := []map[string]interface{}{test.expected}; !reflect.DeepEqual(got, expected) {
+				t.Fatalf("parsing %q yielded %#v; expected %#v", test.input, got, expected)
+			}
+		})
+	}
+}
+
+func TestTabAsSeparator(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		tabs     bool
+		expected map[string]interface{}
+	}{
+		"Spaces In Value":   {input: "key=multi word value\tkey2=x\n", tabs: true, expected: map[string]interface{}{"key": "multi word value", "key2": "x"}},
+		"Number":            {input: "msg=all done\tn=42\n", tabs: true, expected: map[string]interface{}{"msg": "all done", "n": int64(42)}},
+		"Spaced Number":     {input: "n=1 2\n", tabs: true, expected: map[string]interface{}{"n": "1 2"}},
+		"Unchanged Without": {input: "key=multi word value\tkey2=x\n", expected: map[string]interface{}{"key": "multi", "key2": "x"}},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := parseAll(t, test.input, WithTabAsSeparator(test.tabs))
+			if expected := []map[string]interface{}{test.expected}; !reflect.DeepEqual(got, expected) {
+				t.Fatalf("parsing %q yielded %#v; expected %#v", test.input, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestQuoteRunes(t *testing.T) {
+	input := "[time]=[04/Mar/2021:05:06:07 +0000] [request line]=[GET / HTTP/1.1]\n"
+	got := parseAll(t, input, WithQuoteRunes('[', ']'))
+	expected := []map[string]interface{}{{"time": "04/Mar/2021:05:06:07 +0000", "request line": "GET / HTTP/1.1"}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("parsing %q yielded %#v; expected %#v", input, got, expected)
+	}
+}
+
+func TestRawBackslash(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		raw      bool
+		expected map[string]interface{}
+	}{
+		"Path":             {input: `path=C:\logs\app.log` + "\n", expected: map[string]interface{}{"path": `C:\logs\app.log`}},
+		"Path Raw":         {input: `path=C:\logs\app.log` + "\n", raw: true, expected: map[string]interface{}{"path": `C:\logs\app.log`}},
+		"Directory":        {input: `dir=C:\logs\ n=1` + "\n", expected: map[string]interface{}{"dir": `C:\logs n=1`}},
+		"Directory Raw":    {input: `dir=C:\logs\ n=1` + "\n", raw: true, expected: map[string]interface{}{"dir": `C:\logs\`, "n": int64(1)}},
+		"Quoted Directory": {input: `dir="C:\\logs\\"` + "\n", expected: map[string]interface{}{"dir": `C:\logs\`}},
+		"Quoted Raw":       {input: `dir="C:\logs\"` + "\n", raw: true, expected: map[string]interface{}{"dir": `C:\logs\`}},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := parseAll(t, test.input, WithRawBackslash(test.raw))
+			if expected := []map[string]interface{}{test.expected}; !reflect.DeepEqual(got, expected) {
+				t.Fatalf("parsing %q yielded %#v; expected %#v", test.input, got, expected)
+			}
+		})
+	}
+}
+
+func TestKeyTransform(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		opts     []func(*Parser) error
+		expected map[string]interface{}
+	}{
+		"Last Wins": {
+			input:    "Foo=1 FOO=2 bar=3\n",
+			expected: map[string]interface{}{"foo": int64(2), "bar": int64(3)},
+		},
+		"Multi Value": {
+			input:    "Foo=1 FOO=2\n",
+			opts:     []func(*Parser) error{WithMultiValue(true)},
+			expected: map[string]interface{}{"foo": []interface{}{int64(1), int64(2)}},
+		},
+		"Nested": {
+			input:    "HTTP.Status=200\n",
+			opts:     []func(*Parser) error{WithNestedKeys(true)},
+			expected: map[string]interface{}{"http": map[string]interface{}{"status": int64(200)}},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := parseAll(t, test.input, append([]func(*Parser) error{WithKeyTransform(strings.ToLower)}, test.opts...)...)
+			if expected := []map[string]interface{}{test.expected}; !reflect.DeepEqual(got, expected) {
+				t.Fatalf("parsing %q yielded %#v; expected %#v", test.input, got, expected)
+			}
+		})
+	}
+}
+
+func TestSource(t *testing.T) {
+	tests := map[string]struct {
+		opts     []func(*Parser) error
+		expected []map[string]interface{}
+	}{
+		"Default Key": {
+			opts:     []func(*Parser) error{WithSource("app.log")},
+			expected: []map[string]interface{}{{"a": int64(1), SourceKey: "app.log"}, {}, {"b": int64(2), SourceKey: "app.log"}},
+		},
+		"Custom Key": {
+			opts:     []func(*Parser) error{WithSource("app.log"), WithSourceKey("origin")},
+			expected: []map[string]interface{}{{"a": int64(1), "origin": "app.log"}, {}, {"b": int64(2), "origin": "app.log"}},
+		},
+		"No Source": {
+			expected: []map[string]interface{}{{"a": int64(1)}, {}, {"b": int64(2)}},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := parseAll(t, "a=1\n\nb=2\n", test.opts...)
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("parsing yielded %#v; expected %#v", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestByteOrderMark(t *testing.T) {
+	tests := map[string]struct {
+		input string
+		opts  []func(*Parser) error
+	}{
+		"Logfmt": {input: "\uFEFFkey=value\n"},
+		"JSON":   {input: "\uFEFF{\"key\":\"value\"}\n", opts: []func(*Parser) error{WithJSONInput(true)}},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := parseAll(t, test.input, test.opts...)
+			if expected := []map[string]interface{}{{"key": "value"}}; !reflect.DeepEqual(got, expected) {
+				t.Fatalf("parsing %q yielded %#v; expected %#v", test.input, got, expected)
+			}
+		})
+	}
+}
+
+func TestNewlineInValues(t *testing.T) {
+	const input = "trace=\"line1\nline2\" level=error\nnext=1\n"
+
+	t.Run("Allowed", func(t *testing.T) {
+		t.Parallel()
+
+		got := parseAll(t, input, WithNewlineInValues(true), WithLineKey(LineKey))
+		expected := []map[string]interface{}{
+			{"trace": "line1\nline2", "level": "error", LineKey: 1},
+			{"next": int64(1), LineKey: 3},
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Fatalf("parsing %q yielded %#v; expected %#v", input, got, expected)
+		}
+	})
+
+	t.Run("Default", func(t *testing.T) {
+		t.Parallel()
+
+		var errs []error
+		got := parseAll(t, input, WithErrorHandler(func(err error) { errs = append(errs, err) }))
+		// the first line is unterminated and dropped, leaving the rest of
+		// the value to be read as a line of its own.
+		expected := []map[string]interface{}{{"level": "error"}, {"next": int64(1)}}
+		if !reflect.DeepEqual(got, expected) {
+			t.Fatalf("parsing %q yielded %#v; expected %#v", input, got, expected)
+		}
+		if len(errs) != 1 {
+			t.Fatalf("parsing %q reported %v; expected one error", input, errs)
+		}
+	})
+}
+
+func TestDurationField(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		expected interface{}
+	}{
+		"Milliseconds": {input: "took=500ms\n", expected: 500 * time.Millisecond},
+		"Seconds":      {input: "took=1.2s\n", expected: 1200 * time.Millisecond},
+		"Compound":     {input: "took=1h2m\n", expected: time.Hour + 2*time.Minute},
+		"Bare Number":  {input: "took=500\n", expected: int64(500)},
+		"Quoted":       {input: "took=\"250us\"\n", expected: 250 * time.Microsecond},
+		"Not Duration": {input: "took=soon\n", expected: "soon"},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := parseAll(t, test.input+"other=5s\n", WithDurationField("took"))
+			expected := []map[string]interface{}{{"took": test.expected}, {"other": "5s"}}
+			if !reflect.DeepEqual(got, expected) {
+				t.Fatalf("parsing %q yielded %#v; expected %#v", test.input, got, expected)
+			}
+		})
+	}
+}
+
+func TestURLDecode(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		keys     []string
+		expected map[string]interface{}
+	}{
+		"Space":       {input: "q=hello%20world\n", keys: []string{"q"}, expected: map[string]interface{}{"q": "hello world"}},
+		"Plus":        {input: "q=a+b%2Bc\n", keys: []string{"q"}, expected: map[string]interface{}{"q": "a b+c"}},
+		"Malformed":   {input: "q=%zz\n", keys: []string{"q"}, expected: map[string]interface{}{"q": "%zz"}},
+		"Other Key":   {input: "q=a%20b path=a%20b\n", keys: []string{"q"}, expected: map[string]interface{}{"q": "a b", "path": "a%20b"}},
+		"Every Key":   {input: "q=a%20b path=%2Ftmp\n", expected: map[string]interface{}{"q": "a b", "path": "/tmp"}},
+		"Number Kept": {input: "n=10\n", expected: map[string]interface{}{"n": int64(10)}},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := parseAll(t, test.input, WithURLDecode(test.keys...))
+			if expected := []map[string]interface{}{test.expected}; !reflect.DeepEqual(got, expected) {
+				t.Fatalf("parsing %q yielded %#v; expected %#v", test.input, got, expected)
+			}
+		})
+	}
+}
+
+func TestPanicRecovery(t *testing.T) {
+	tests := map[string]struct {
+		input string
+		opts  []func(*Parser) error
+	}{
+		"Logfmt": {input: "a=1\nboom=2 c=3\nd=4\n"},
+		"JSON": {
+			input: "{\"a\":1}\n{\"boom\":2,\"c\":3}\n{\"d\":4}\n",
+			opts:  []func(*Parser) error{WithJSONInput(true)},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var errs []error
+			opts := append([]func(*Parser) error{
+				WithReader(strings.NewReader(test.input)),
+				WithErrorHandler(func(err error) { errs = append(errs, err) }),
+				WithKeyTransform(func(key string) string {
+					if key == "boom" {
+						panic("cannot transform " + key)
+					}
+					return key
+				}),
+			}, test.opts...)
+
+			p, err := NewParser(opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := []map[string]interface{}{}
+			for m := range p.Parse() {
+				got = append(got, m)
+			}
+
+			expected := []map[string]interface{}{{"a": int64(1)}, {"d": int64(4)}}
+			if !reflect.DeepEqual(got, expected) {
+				t.Fatalf("parsing %q yielded %#v; expected %#v", test.input, got, expected)
+			}
+
+			var lineErr *LineError
+			if len(errs) != 1 || !errors.As(errs[0], &lineErr) || lineErr.Line != 2 {
+				t.Fatalf("parsing %q reported %v; expected a single error on line 2", test.input, errs)
+			}
+			if stats := p.Stats(); stats.Skipped != 1 {
+				t.Fatalf("parsing %q skipped %d lines; expected 1", test.input, stats.Skipped)
+			}
+		})
+	}
+}
+
+func TestValueTransform(t *testing.T) {
+	const input = "card=4111111111111111 user=bob took=5s\n"
+
+	got := parseAll(t, input,
+		WithDurationField("took"),
+		WithValueTransform(func(key string, value interface{}) interface{} {
+			switch v := value.(type) {
+			case int64:
+				if key == "card" {
+					s := strconv.FormatInt(v, 10)
+					return strings.Repeat("*", len(s)-4) + s[len(s)-4:]
+				}
+			case time.Duration:
+				return v.Seconds()
+			}
+			return value
+		}))
+
+	expected := []map[string]interface{}{{"card": "************1111", "user": "bob", "took": 5.0}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("parsing %q yielded %#v; expected %#v", input, got, expected)
+	}
+}
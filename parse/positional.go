@@ -0,0 +1,101 @@
+package parse
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ayang64/ginsu/lex"
+)
+
+// WithPositionalFields reads lines that have no keys, such as the Apache
+// common log format, by giving each white space separated field of a line the
+// name at the same position in names.  quotes group a field that holds white
+// space and are removed.  a line with fewer fields than names leaves the
+// remaining names unset; fields past the last name are dropped.  a field that
+// is a number alone is typed as one; otherwise it keeps the text it was
+// written with.
+func WithPositionalFields(names ...string) func(*Parser) error {
+	return func(p *Parser) error {
+		if len(names) == 0 {
+			return fmt.Errorf("positional fields need at least one name")
+		}
+		p.positional = names
+		p.lexOpts = append(p.lexOpts, lex.WithRawNumbers(true))
+		return nil
+	}
+}
+
+// fields is the Reducer for WithPositionalFields.  a field is normally a
+// single token, but tokens that run together with no white space between them
+// (such as a=b, which lexes as three) are joined into a single string.
+type fields struct {
+	p *Parser
+
+	// line points at the number of the line being parsed, for logging.
+	line *int
+
+	kvp   map[string]interface{}
+	n     int
+	toks  []lex.Token
+	extra int
+}
+
+func newFields(p *Parser, line *int) *fields {
+	return &fields{p: p, line: line, kvp: p.newRecord()}
+}
+
+// Feed adds tok to the field being gathered, or ends the field if tok is
+// white space.  the end of the line ends its record.
+func (f *fields) Feed(tok lex.Token) (map[string]interface{}, bool) {
+	switch tok.Type {
+	case lex.TokenWhiteSpace:
+		f.end()
+	case lex.TokenNewLine, lex.TokenEOF:
+		kvp := f.kvp
+		defer f.reset()
+		f.end()
+		return kvp, true
+	default:
+		f.toks = append(f.toks, tok)
+	}
+	return nil, false
+}
+
+// end stores the field being gathered, if there is one, under its name.
+func (f *fields) end() {
+	if len(f.toks) == 0 {
+		return
+	}
+
+	defer func() { f.toks = f.toks[:0] }()
+
+	if f.n >= len(f.p.positional) {
+		f.extra++
+		return
+	}
+
+	// numbers are lexed raw, so a joined field is built from the text of its
+	// tokens.
+	var value interface{} = f.toks[0].Value
+	if len(f.toks) > 1 {
+		sb := &strings.Builder{}
+		for _, tok := range f.toks {
+			sb.WriteString(tokenString(tok))
+		}
+		value = sb.String()
+	} else if s, isString := value.(string); isString && f.toks[0].Type == lex.TokenNumber {
+		value, _ = lex.ParseNumber(s)
+	}
+
+	f.p.store(f.kvp, f.p.positional[f.n], value)
+	f.n++
+}
+
+// reset readies the fields for the next line, logging any fields of this one
+// that had no name.  it runs even if storing a field panicked.
+func (f *fields) reset() {
+	if f.extra > 0 {
+		f.p.logf(lex.LevelInfo, "line %d: %d fields past the last positional name were dropped", *f.line, f.extra)
+	}
+	f.kvp, f.n, f.extra, f.toks = f.p.newRecord(), 0, 0, f.toks[:0]
+}
@@ -0,0 +1,35 @@
+package parse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPositionalFields(t *testing.T) {
+	names := []string{"host", "ident", "user"}
+
+	tests := map[string]struct {
+		input    string
+		expected map[string]interface{}
+	}{
+		"Three Fields":   {input: "127.0.0.1 - frank\n", expected: map[string]interface{}{"host": "127.0.0.1", "ident": "-", "user": "frank"}},
+		"Fewer Fields":   {input: "127.0.0.1 -\n", expected: map[string]interface{}{"host": "127.0.0.1", "ident": "-"}},
+		"More Fields":    {input: "a b c d e\n", expected: map[string]interface{}{"host": "a", "ident": "b", "user": "c"}},
+		"Quoted Field":   {input: "h \"GET / HTTP/1.0\" 200\n", expected: map[string]interface{}{"host": "h", "ident": "GET / HTTP/1.0", "user": int64(200)}},
+		"Joined Tokens":  {input: "h a=b x\n", expected: map[string]interface{}{"host": "h", "ident": "a=b", "user": "x"}},
+		"Extra Space":    {input: "  a   b\tc  \n", expected: map[string]interface{}{"host": "a", "ident": "b", "user": "c"}},
+		"Joined Numbers": {input: "id=0x1F v=1.0 0x1F\n", expected: map[string]interface{}{"host": "id=0x1F", "ident": "v=1.0", "user": int64(31)}},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := parseAll(t, test.input, WithPositionalFields(names...))
+			if expected := []map[string]interface{}{test.expected}; !reflect.DeepEqual(got, expected) {
+				t.Fatalf("parsing %q yielded %#v; expected %#v", test.input, got, expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package parse
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"unicode/utf8"
+)
+
+// RawKey is the key under which WithRawLine stores the text of the line a
+// record was parsed from.
+const RawKey = "_raw"
+
+// WithRawLine stores the text of the line each non-empty record was parsed
+// from under RawKey, exactly as it appeared in the input: quotes and escapes
+// are kept and only the line's delimiter is dropped.  it has no effect when
+// the input comes from WithLexer.
+func WithRawLine(raw bool) func(*Parser) error {
+	return func(p *Parser) error {
+		p.rawLine = raw
+		return nil
+	}
+}
+
+// rawRecorder keeps a copy of everything read through it until it is taken a
+// line at a time.  the lexer reads from it on its own goroutine while the
+// parser takes lines, so it is locked.
+type rawRecorder struct {
+	r     io.Reader
+	delim []byte
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+func newRawRecorder(r io.Reader, delim rune) *rawRecorder {
+	enc := make([]byte, utf8.RuneLen(delim))
+	utf8.EncodeRune(enc, delim)
+	return &rawRecorder{r: r, delim: enc}
+}
+
+func (rr *rawRecorder) Read(p []byte) (int, error) {
+	n, err := rr.r.Read(p)
+
+	rr.mu.Lock()
+	rr.buf = append(rr.buf, p[:n]...)
+	rr.mu.Unlock()
+
+	return n, err
+}
+
+// take removes the input up to and including the nth delimiter and returns it
+// without that delimiter.  a record whose quoted strings span lines covers
+// more than one delimiter.  if fewer than n delimiters have been read,
+// everything read is taken.
+func (rr *rawRecorder) take(n int) string {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	end := 0
+	for ; n > 0; n-- {
+		i := bytes.Index(rr.buf[end:], rr.delim)
+		if i < 0 {
+			line := string(rr.buf)
+			rr.buf = rr.buf[:0]
+			return line
+		}
+		end += i + len(rr.delim)
+	}
+
+	line := string(rr.buf[:end-len(rr.delim)])
+	rr.buf = rr.buf[:copy(rr.buf, rr.buf[end:])]
+	return line
+}
@@ -0,0 +1,57 @@
+package parse
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ayang64/ginsu/lex"
+)
+
+func TestRawLine(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		opts     []func(*Parser) error
+		expected []string
+	}{
+		"Quotes And Escapes": {
+			input:    `msg="say \"hi\""  n=0x1F path=a\=b` + "\n" + `next='x'` + "\n",
+			expected: []string{`msg="say \"hi\""  n=0x1F path=a\=b`, `next='x'`},
+		},
+		"Dropped Lines": {
+			input:    "a=1\nb=\"oops\n\nc=3\n",
+			expected: []string{"a=1", "c=3"},
+		},
+		"Spanning Lines": {
+			input:    "a=\"one\ntwo\" b=2\nc=3\n",
+			opts:     []func(*Parser) error{WithLexerOptions(lex.WithMultilineQuotes(true))},
+			expected: []string{"a=\"one\ntwo\" b=2", "c=3"},
+		},
+		"Unterminated Last Line": {
+			input:    "a=1\nb=2",
+			expected: []string{"a=1", "b=2"},
+		},
+		"JSON": {
+			input:    "{\"a\": 1}\n {\"b\":2}\n",
+			opts:     []func(*Parser) error{WithJSONInput(true)},
+			expected: []string{`{"a": 1}`, ` {"b":2}`},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := []string{}
+			for _, m := range parseAll(t, test.input, append([]func(*Parser) error{WithRawLine(true), WithErrorHandler(func(error) {})}, test.opts...)...) {
+				if len(m) > 0 {
+					got = append(got, m[RawKey].(string))
+				}
+			}
+
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("parsing %q yielded raw lines %q; expected %q", test.input, got, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package parse
+
+import (
+	"sort"
+	"strings"
+)
+
+// Record wraps a parsed record for lookups that ignore the case of its keys,
+// since producers don't agree on whether it's requestId or RequestID.  the
+// record itself keeps its keys as they were written.
+type Record struct {
+	m map[string]interface{}
+
+	// lower maps the lowercase form of each key in m to the key.  it is
+	// built by the first lookup that needs it.
+	lower map[string]string
+}
+
+// NewRecord wraps m.  m must not be changed once Get has been called.
+func NewRecord(m map[string]interface{}) *Record {
+	return &Record{m: m}
+}
+
+// Get returns the value of key, matched without regard to case.  a key that
+// matches exactly wins; if several keys differ only in case the first of them
+// in sorted order is used.
+func (r *Record) Get(key string) (interface{}, bool) {
+	if v, exists := r.m[key]; exists {
+		return v, true
+	}
+
+	if r.lower == nil {
+		keys := make([]string, 0, len(r.m))
+		for k := range r.m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		r.lower = make(map[string]string, len(keys))
+		for _, k := range keys {
+			if lk := strings.ToLower(k); r.lower[lk] == "" {
+				r.lower[lk] = k
+			}
+		}
+	}
+
+	k, exists := r.lower[strings.ToLower(key)]
+	if !exists {
+		return nil, false
+	}
+	return r.m[k], true
+}
+
+// SortedKeys returns the keys of the record in sorted order.  the keys of a
+// nested map, as built by WithNestedKeys, are listed in its place as dotted
+// paths, so {"b": {"c": 1}, "a": 2} has the keys a and b.c.
+func (r *Record) SortedKeys() []string {
+	keys := []string{}
+
+	var walk func(prefix string, m map[string]interface{})
+	walk = func(prefix string, m map[string]interface{}) {
+		for k, v := range m {
+			if nested, isMap := v.(map[string]interface{}); isMap {
+				walk(prefix+k+".", nested)
+				continue
+			}
+			keys = append(keys, prefix+k)
+		}
+	}
+	walk("", r.m)
+
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,47 @@
+package parse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRecordGet(t *testing.T) {
+	rec := NewRecord(map[string]interface{}{"RequestID": "r1", "level": "info", "Dup": 1, "DUP": 2, "dup": 3})
+
+	tests := map[string]struct {
+		key      string
+		expected interface{}
+		exists   bool
+	}{
+		"Lowercase": {key: "requestid", expected: "r1", exists: true},
+		"Uppercase": {key: "LEVEL", expected: "info", exists: true},
+		"Exact":     {key: "Dup", expected: 1, exists: true},
+		"Ambiguous": {key: "dUp", expected: 2, exists: true},
+		"Missing":   {key: "user"},
+	}
+
+	// the subtests share rec, which builds its index on first use, so they
+	// don't run in parallel.
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			if got, exists := rec.Get(test.key); got != test.expected || exists != test.exists {
+				t.Fatalf("Get(%q) returned %v, %v; expected %v, %v", test.key, got, exists, test.expected, test.exists)
+			}
+		})
+	}
+}
+
+func TestSortedKeys(t *testing.T) {
+	rec := NewRecord(map[string]interface{}{
+		"level": "info",
+		"http":  map[string]interface{}{"status": 200, "method": "GET"},
+		"Zone":  "a",
+		"app":   "web",
+	})
+
+	expected := []string{"Zone", "app", "http.method", "http.status", "level"}
+	if got := rec.SortedKeys(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("SortedKeys() returned %q; expected %q", got, expected)
+	}
+}
@@ -0,0 +1,268 @@
+package parse
+
+import (
+	"fmt"
+
+	"github.com/ayang64/ginsu/lex"
+)
+
+// Reducer builds records out of the tokens of the input.  the parser feeds it
+// every token of a line in turn, except comments, errors and unidentified
+// input, which the parser deals with itself, followed by the TokenNewLine
+// that ends the line.  a last line that ends without a delimiter is followed
+// by a TokenEOF instead.
+//
+// Feed returns a record along with true once tok completes one.  a nil record
+// drops whatever was gathered, counting the line as skipped.  a reducer should
+// start afresh after every TokenNewLine since a line whose record was dropped
+// part way, say because of a lexing error, is not fed the rest of its tokens.
+type Reducer interface {
+	Feed(tok lex.Token) (record map[string]interface{}, done bool)
+}
+
+// WithReducer makes r, rather than the logfmt grammar, build the records of
+// the input.  WithPositionalFields then has no effect.  it has no effect on
+// JSON input either.
+func WithReducer(r Reducer) func(*Parser) error {
+	return func(p *Parser) error {
+		p.reducer = r
+		return nil
+	}
+}
+
+// state is where the parser is within the pair grammar.
+type state int
+
+const (
+	stateKey         = state(iota) // expecting a key
+	stateSep                       // have a key, expecting '='
+	stateSpacedSep                 // have a key and white space, expecting '=' or the next key
+	stateValue                     // have a key and '=', expecting a value
+	stateSpacedValue               // have a key, '=' and white space, expecting a value
+	stateCandidate                 // have a value past white space, which may be the next key
+	stateNext                      // have a pair, expecting white space
+	stateSkip                      // malformed input; ignoring it until white space
+)
+
+func (s state) String() string {
+	m := map[state]string{
+		stateKey:         "KEY",
+		stateSep:         "SEPARATOR",
+		stateSpacedSep:   "SPACED-SEPARATOR",
+		stateValue:       "VALUE",
+		stateSpacedValue: "SPACED-VALUE",
+		stateCandidate:   "CANDIDATE",
+		stateNext:        "NEXT",
+		stateSkip:        "SKIP",
+	}
+	if name, ok := m[s]; ok {
+		return name
+	}
+	return "UNKNOWN"
+}
+
+// logfmt is the default Reducer.  the grammar of a line is:
+//
+// line := pair (WHITE-SPACE pair)*
+// 			;
+//
+// pair := key '=' value
+// 			;
+//
+// key := QSTRING | ATOM
+// 			;
+//
+// value := QSTRING | ATOM | NUMBER
+// 			;
+//
+// white space is allowed on either side of the '=', so key = value is a pair.
+// a value past white space is only known to be one at the white space or end
+// of line that follows it: in a= b=2 it is the key of the next pair, leaving a
+// with an empty value.  a key with no '=' at all has no value and is dropped.
+//
+// anything that doesn't fit is malformed.  we drop it and pick up again at the
+// next white space so one bad pair can't shift every pair after it.
+type logfmt struct {
+	p *Parser
+
+	// line points at the number of the line being parsed, for logging.
+	line *int
+
+	state state
+	key   string
+	kvp   map[string]interface{}
+
+	// candidate is the value held in stateCandidate.
+	candidate lex.Token
+
+	// malformed is the first input of the line found not to fit the grammar,
+	// which fails the line under WithStrict.
+	malformed error
+}
+
+func newLogfmt(p *Parser, line *int) *logfmt {
+	return &logfmt{p: p, line: line, kvp: p.newRecord()}
+}
+
+// takeKey starts a pair with the key held by tok.
+func (r *logfmt) takeKey(tok lex.Token) {
+	r.key, r.state = tokenString(tok), stateSep
+	if r.key == "" {
+		// a quoted key can be empty but a record can't hold it
+		// meaningfully.
+		r.reject("empty key")
+		r.state = stateSkip
+	}
+}
+
+// reject notes input that doesn't fit the grammar.  it is logged and the
+// caller carries on past it, unless WithStrict was given, which fails the line.
+func (r *logfmt) reject(format string, args ...interface{}) {
+	if !r.p.strict {
+		r.p.logf(lex.LevelInfo, "line %d: "+format, append([]interface{}{*r.line}, args...)...)
+		return
+	}
+	if r.malformed == nil {
+		r.malformed = fmt.Errorf(format, args...)
+	}
+}
+
+// isValue reports whether a token of type t can be a value.  the tokens of
+// scanners added with lex.RegisterScanner are values too.
+func isValue(t lex.TokenType) bool {
+	return t == lex.TokenAtom || t == lex.TokenNumber || t == lex.TokenQuotedString || t.Custom()
+}
+
+// storeValue stores value under the key of the pair, unless it is empty and
+// WithSkipEmptyValues was given.
+func (r *logfmt) storeValue(value interface{}) {
+	if s, isString := value.(string); isString && s == "" && r.p.skipEmpty {
+		r.p.logf(lex.LevelDebug, "line %d: skipping the empty value of %q", *r.line, r.key)
+		return
+	}
+	r.p.store(r.kvp, r.key, value)
+	r.p.logf(lex.LevelDebug, "kvp is now %#v", r.kvp)
+}
+
+func (r *logfmt) Feed(tok lex.Token) (map[string]interface{}, bool) {
+	p, line := r.p, *r.line
+
+	if tok.Type == lex.TokenNewLine || tok.Type == lex.TokenEOF {
+		// the reset is deferred so that it happens even if storing the
+		// last value panics.
+		kvp := r.kvp
+		defer func() { r.kvp, r.state, r.malformed = p.newRecord(), stateKey, nil }()
+
+		switch r.state {
+		case stateSep, stateSpacedSep:
+			// a bare key at the end of a line is only worth mentioning
+			// when it fails the line.
+			if p.strict {
+				r.reject("key %q has no value", r.key)
+			}
+		case stateValue, stateSpacedValue:
+			r.storeValue("")
+		case stateCandidate:
+			r.storeValue(r.candidate.Value)
+		}
+
+		if r.malformed != nil {
+			p.report(&LineError{Line: line, Err: r.malformed})
+			return nil, true
+		}
+		return kvp, true
+	}
+
+	p.logf(lex.LevelDebug, "state %v, token %v", r.state, tok)
+
+	space := tok.Type == lex.TokenWhiteSpace
+
+	switch r.state {
+	case stateKey:
+		switch {
+		case space:
+		case tok.Type == lex.TokenAtom || tok.Type == lex.TokenQuotedString:
+			r.takeKey(tok)
+		default:
+			r.reject("%v where a key was expected", tok)
+			r.state = stateSkip
+		}
+
+	case stateSep, stateSpacedSep:
+		switch {
+		case tok.Type == lex.TokenEqual:
+			r.state = stateValue
+		case space:
+			r.state = stateSpacedSep
+		case r.state == stateSpacedSep && (tok.Type == lex.TokenAtom || tok.Type == lex.TokenQuotedString):
+			// white space followed a bare key, so this is the key of the
+			// next pair.
+			r.reject("key %q has no value", r.key)
+			r.takeKey(tok)
+		default:
+			r.reject("%v follows key %q", tok, r.key)
+			r.state = stateSkip
+		}
+
+	case stateValue:
+		switch {
+		case isValue(tok.Type):
+			// the state moves on first so a value that panics as it is
+			// stored isn't stored again at the end of the line.
+			r.state = stateNext
+			r.storeValue(tok.Value)
+		case space && p.trimValues:
+		case space:
+			r.state = stateSpacedValue
+		default:
+			r.reject("%v where the value of %q was expected", tok, r.key)
+			r.state = stateSkip
+		}
+
+	case stateSpacedValue:
+		switch {
+		case space:
+		case isValue(tok.Type):
+			r.candidate, r.state = tok, stateCandidate
+		default:
+			r.reject("%v where the value of %q was expected", tok, r.key)
+			r.state = stateSkip
+		}
+
+	case stateCandidate:
+		switch {
+		case space:
+			r.state = stateKey
+			r.storeValue(r.candidate.Value)
+		case tok.Type == lex.TokenEqual:
+			// the candidate is the key of the next pair, so this one's
+			// value is empty.
+			r.state = stateSkip
+			r.storeValue("")
+			if r.candidate.Type == lex.TokenNumber {
+				r.reject("%v where a key was expected", r.candidate)
+				break
+			}
+			if r.takeKey(r.candidate); r.state == stateSep {
+				r.state = stateValue
+			}
+		default:
+			r.reject("%v follows the value of %q", tok, r.key)
+			r.state = stateSkip
+		}
+
+	case stateNext:
+		if !space {
+			r.reject("%v follows the value of %q", tok, r.key)
+			r.state = stateSkip
+			break
+		}
+		r.state = stateKey
+
+	case stateSkip:
+		if space {
+			r.state = stateKey
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,128 @@
+package parse
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ayang64/ginsu/lex"
+)
+
+func TestLogfmtReducer(t *testing.T) {
+	p, err := NewParser()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line := 1
+	r := newLogfmt(p, &line)
+
+	toks := []lex.Token{
+		{Type: lex.TokenAtom, Value: "a"},
+		{Type: lex.TokenEqual, Value: "="},
+		{Type: lex.TokenNumber, Value: int64(1)},
+		{Type: lex.TokenWhiteSpace, Value: " "},
+		{Type: lex.TokenAtom, Value: "b"},
+		{Type: lex.TokenEqual, Value: "="},
+		{Type: lex.TokenQuotedString, Value: "x y"},
+	}
+	for _, tok := range toks {
+		if _, done := r.Feed(tok); done {
+			t.Fatalf("feeding %v finished the record early", tok)
+		}
+	}
+
+	got, done := r.Feed(lex.Token{Type: lex.TokenNewLine, Value: "\n"})
+	if !done {
+		t.Fatal("the end of the line didn't finish the record")
+	}
+	if expected := map[string]interface{}{"a": int64(1), "b": "x y"}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("reducing %v yielded %#v; expected %#v", toks, got, expected)
+	}
+
+	// the next line starts with an empty record.
+	if got, _ := r.Feed(lex.Token{Type: lex.TokenEOF}); len(got) != 0 {
+		t.Fatalf("the next record started with %#v", got)
+	}
+}
+
+func TestCustomTokenValue(t *testing.T) {
+	// a scanner that never takes the input is enough for a type of its own.
+	custom := lex.RegisterScanner(func(rune) bool { return false }, nil)
+
+	p, err := NewParser()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line := 1
+	r := newLogfmt(p, &line)
+
+	toks := []lex.Token{
+		{Type: lex.TokenAtom, Value: "id"},
+		{Type: lex.TokenEqual, Value: "="},
+		{Type: custom, Value: "123e4567-e89b-12d3-a456-426614174000"},
+		{Type: lex.TokenWhiteSpace, Value: " "},
+		{Type: lex.TokenAtom, Value: "parent"},
+		{Type: lex.TokenWhiteSpace, Value: " "},
+		{Type: lex.TokenEqual, Value: "="},
+		{Type: lex.TokenWhiteSpace, Value: " "},
+		{Type: custom, Value: "987e6543-e89b-12d3-a456-426614174000"},
+		{Type: lex.TokenNewLine, Value: "\n"},
+	}
+	var got map[string]interface{}
+	for _, tok := range toks {
+		got, _ = r.Feed(tok)
+	}
+
+	expected := map[string]interface{}{"id": "123e4567-e89b-12d3-a456-426614174000", "parent": "987e6543-e89b-12d3-a456-426614174000"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("reducing %v yielded %#v; expected %#v", toks, got, expected)
+	}
+}
+
+// words is a Reducer that counts the atoms of each line, dropping lines that
+// mention "secret".
+type words struct {
+	n      int64
+	secret bool
+}
+
+func (w *words) Feed(tok lex.Token) (map[string]interface{}, bool) {
+	switch tok.Type {
+	case lex.TokenNewLine, lex.TokenEOF:
+		n, secret := w.n, w.secret
+		w.n, w.secret = 0, false
+		if secret {
+			return nil, true
+		}
+		return map[string]interface{}{"words": n}, true
+	case lex.TokenAtom:
+		w.n++
+		w.secret = w.secret || tok.Value == "secret"
+	}
+	return nil, false
+}
+
+func TestWithReducer(t *testing.T) {
+	const input = "the quick brown fox\na secret word\njumps over"
+
+	p, err := NewParser(WithReader(strings.NewReader(input)), WithReducer(&words{}), WithLineKey(LineKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []map[string]interface{}{}
+	for m := range p.Parse() {
+		got = append(got, m)
+	}
+
+	expected := []map[string]interface{}{{"words": int64(4), LineKey: 1}, {"words": int64(2), LineKey: 3}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("parsing %q yielded %#v; expected %#v", input, got, expected)
+	}
+
+	if stats, expected := p.Stats(), (Stats{Lines: 3, Records: 2, Skipped: 1}); stats != expected {
+		t.Fatalf("parsing %q yielded stats %+v; expected %+v", input, stats, expected)
+	}
+}
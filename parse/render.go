@@ -0,0 +1,73 @@
+package parse
+
+import (
+	"io"
+	"text/template"
+)
+
+// Renderer renders every non-empty record of an input with a template.  it is
+// an io.WriterTo, so the whole stream can be written with a single call, say
+// to an http.ResponseWriter or a file.
+type Renderer struct {
+	r    io.Reader
+	tmpl *template.Template
+	opts []func(*Parser) error
+}
+
+// NewRenderer returns a renderer of the records of r.  opts configure the
+// parser; WithReader is already given.
+func NewRenderer(r io.Reader, tmpl *template.Template, opts ...func(*Parser) error) *Renderer {
+	return &Renderer{r: r, tmpl: tmpl, opts: opts}
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// WriteTo parses the input and writes each record, rendered, to w.  it returns
+// the number of bytes written.  if tmpl fails to execute, or w fails, the bytes
+// written up to then are returned along with the error, including any that the
+// failing record wrote before the template broke off.
+func (rd *Renderer) WriteTo(w io.Writer) (int64, error) {
+	p, err := NewParser(append([]func(*Parser) error{WithReader(rd.r)}, rd.opts...)...)
+	if err != nil {
+		return 0, err
+	}
+
+	cw := &countingWriter{w: w}
+	err = p.ParseFunc(func(m map[string]interface{}) error {
+		if len(m) == 0 {
+			return nil
+		}
+		return rd.tmpl.Execute(cw, m)
+	})
+	return cw.n, err
+}
+
+// RenderStream parses r and returns a reader of every non-empty record
+// rendered with tmpl, in order.  records are rendered as the returned reader
+// is read, through an io.Pipe, so a slow reader holds back parsing instead of
+// output piling up in memory.  opts configure the parser; WithReader is
+// already given.
+//
+// if tmpl fails to execute, or the parser can't be built, reading returns
+// that error.  closing the reader stops parsing early.
+func RenderStream(r io.Reader, tmpl *template.Template, opts ...func(*Parser) error) io.ReadCloser {
+	pr, pw := io.Pipe()
+
+	go func() {
+		// a nil error closes the pipe normally, so the reader sees io.EOF.
+		_, err := NewRenderer(r, tmpl, opts...).WriteTo(pw)
+		pw.CloseWithError(err)
+	}()
+
+	return pr
+}
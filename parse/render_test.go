@@ -0,0 +1,119 @@
+package parse
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestRenderStream(t *testing.T) {
+	tests := map[string]struct {
+		input     string
+		tmpl      string
+		expected  string
+		shouldErr bool
+	}{
+		"Records":     {input: "a=1 b=x\n\na=2 b=y\n", tmpl: "{{.a}}:{{.b}}\n", expected: "1:x\n2:y\n"},
+		"No Records":  {input: "\n\n", tmpl: "{{.a}}\n", expected: ""},
+		"Exec Error":  {input: "a=1\na=2\n", tmpl: "{{.a}}{{index .a 1}}\n", expected: "1", shouldErr: true},
+		"Funcs Apply": {input: "level=warn\n", tmpl: "{{upper .level}}\n", expected: "WARN\n"},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			tmpl := template.Must(template.New("x").Funcs(FuncMap()).Parse(test.tmpl))
+
+			got, err := ioutil.ReadAll(RenderStream(strings.NewReader(test.input), tmpl))
+			if test.shouldErr != (err != nil) {
+				t.Fatalf("reading the stream returned error %v; expected an error: %v", err, test.shouldErr)
+			}
+
+			if string(got) != test.expected {
+				t.Fatalf("the stream yielded %q; expected %q", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestRenderStreamClose(t *testing.T) {
+	input := strings.Repeat("a=1\n", 10000)
+	tmpl := template.Must(template.New("x").Parse("{{.a}}\n"))
+
+	rc := RenderStream(strings.NewReader(input), tmpl)
+	if _, err := io.ReadFull(rc, make([]byte, 4)); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rc.Read(make([]byte, 1)); err != io.ErrClosedPipe {
+		t.Fatalf("reading a closed stream returned %v; expected %v", err, io.ErrClosedPipe)
+	}
+}
+
+// failingWriter accepts n bytes and then fails.
+type failingWriter struct {
+	n int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		written := w.n
+		w.n = 0
+		return written, io.ErrShortWrite
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestRendererWriteTo(t *testing.T) {
+	tests := map[string]struct {
+		input     string
+		tmpl      string
+		expected  string
+		shouldErr bool
+	}{
+		"Records":    {input: "a=1 b=x\n\na=2 b=y\n", tmpl: "{{.a}}:{{.b}}\n", expected: "1:x\n2:y\n"},
+		"No Records": {input: "\n\n", tmpl: "{{.a}}\n", expected: ""},
+		"Exec Error": {input: "a=1\na=2\n", tmpl: "{{.a}}\n{{if eq .a 2}}{{index .a 1}}{{end}}", expected: "1\n2\n", shouldErr: true},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			tmpl := template.Must(template.New("x").Parse(test.tmpl))
+
+			var sb strings.Builder
+			n, err := NewRenderer(strings.NewReader(test.input), tmpl).WriteTo(&sb)
+			if test.shouldErr != (err != nil) {
+				t.Fatalf("WriteTo() returned error %v; expected an error: %v", err, test.shouldErr)
+			}
+
+			if sb.String() != test.expected {
+				t.Fatalf("WriteTo() wrote %q; expected %q", sb.String(), test.expected)
+			}
+			if n != int64(len(test.expected)) {
+				t.Fatalf("WriteTo() returned %d; expected %d", n, len(test.expected))
+			}
+		})
+	}
+}
+
+func TestRendererWriteToShortWrite(t *testing.T) {
+	tmpl := template.Must(template.New("x").Parse("{{.a}}\n"))
+
+	n, err := NewRenderer(strings.NewReader("a=10\na=20\n"), tmpl).WriteTo(&failingWriter{n: 4})
+	if err != io.ErrShortWrite {
+		t.Fatalf("WriteTo() returned error %v; expected %v", err, io.ErrShortWrite)
+	}
+	if n != 4 {
+		t.Fatalf("WriteTo() returned %d; expected 4", n)
+	}
+}
@@ -0,0 +1,29 @@
+package parse
+
+// Stats counts what became of the lines of the input.
+type Stats struct {
+	Lines   int // lines read
+	Records int // lines that yielded a non-empty record
+	Empty   int // lines that yielded an empty record, such as blank lines
+	Skipped int // lines dropped because of an error
+	Errors  int // errors reported, see WithErrorHandler
+	Dropped int // pairs left out by WithAllowedKeys or WithFieldLimit
+}
+
+// Add adds the counts in o to s.  it's useful for totalling the stats of
+// several parsers.
+func (s *Stats) Add(o Stats) {
+	s.Lines += o.Lines
+	s.Records += o.Records
+	s.Empty += o.Empty
+	s.Skipped += o.Skipped
+	s.Errors += o.Errors
+	s.Dropped += o.Dropped
+}
+
+// Stats returns the counts gathered so far.  it must not be called while the
+// parser is running, so call it after the channel returned by Parse() has
+// been closed or ParseFunc() has returned.
+func (p *Parser) Stats() Stats {
+	return p.stats
+}
@@ -0,0 +1,48 @@
+package parse
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		opts     []func(*Parser) error
+		expected Stats
+	}{
+		"Logfmt": {
+			input:    "a=1\n\nb=\"open\nc=3 d=4\n\n",
+			expected: Stats{Lines: 5, Records: 2, Empty: 2, Skipped: 1, Errors: 1},
+		},
+		"Unterminated Last Line": {
+			input:    "a=1\nb=2",
+			expected: Stats{Lines: 2, Records: 2},
+		},
+		"JSON": {
+			input:    "{\"a\":1}\n\n{bad\n{\"c\":3}\n",
+			opts:     []func(*Parser) error{WithJSONInput(true)},
+			expected: Stats{Lines: 4, Records: 2, Empty: 1, Skipped: 1, Errors: 1},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			opts := append([]func(*Parser) error{WithReader(strings.NewReader(test.input)), WithErrorHandler(func(error) {})}, test.opts...)
+			p, err := NewParser(opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for range p.Parse() {
+			}
+
+			if got := p.Stats(); got != test.expected {
+				t.Fatalf("parsing %q yielded stats %+v; expected %+v", test.input, got, test.expected)
+			}
+		})
+	}
+}
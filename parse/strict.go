@@ -0,0 +1,15 @@
+package parse
+
+// WithStrict fails every line that doesn't fit the logfmt grammar, where by
+// default the parser drops what it can't make sense of and keeps the rest.  a
+// stray '=', a key without a value, such as a lone quoted string, and input
+// the lexer can't identify each abandon the line and are reported as a
+// *LineError, whatever WithOnUnidentified says.  it suits checking that a
+// producer writes clean logfmt.  the grammar checks have no effect when the
+// records are built by WithReducer or WithPositionalFields.
+func WithStrict(strict bool) func(*Parser) error {
+	return func(p *Parser) error {
+		p.strict = strict
+		return nil
+	}
+}
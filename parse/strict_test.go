@@ -0,0 +1,67 @@
+package parse
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestStrict(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		strict   bool
+		expected []map[string]interface{}
+		lines    []int
+	}{
+		"Clean": {
+			input:    "a=1 b=\"two words\" c=\nd = 4\n",
+			strict:   true,
+			expected: []map[string]interface{}{{"a": int64(1), "b": "two words", "c": ""}, {"d": int64(4)}},
+			lines:    []int{},
+		},
+		"Dirty": {
+			input:  "a=1\n=2\nb=3\n\"alone\"\nc=4 d\ne=5 \x01\ng=6 h=7\n",
+			strict: true,
+			expected: []map[string]interface{}{
+				{"a": int64(1)},
+				{"b": int64(3)},
+				{"g": int64(6), "h": int64(7)},
+			},
+			lines: []int{2, 4, 5, 6},
+		},
+		"Lenient": {
+			input:  "a=1\n=2\nb=3\n\"alone\"\nc=4 d\n",
+			strict: false,
+			expected: []map[string]interface{}{
+				{"a": int64(1)},
+				{},
+				{"b": int64(3)},
+				{},
+				{"c": int64(4)},
+			},
+			lines: []int{},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			lines := []int{}
+			got := parseAll(t, test.input, WithStrict(test.strict), WithErrorHandler(func(err error) {
+				var lineErr *LineError
+				if errors.As(err, &lineErr) {
+					lines = append(lines, lineErr.Line)
+				}
+			}))
+
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("parsing %q yielded %#v; expected %#v", test.input, got, test.expected)
+			}
+			if !reflect.DeepEqual(lines, test.lines) {
+				t.Fatalf("parsing %q reported errors on lines %v; expected %v", test.input, lines, test.lines)
+			}
+		})
+	}
+}
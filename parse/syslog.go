@@ -0,0 +1,21 @@
+package parse
+
+import "github.com/ayang64/ginsu/lex"
+
+// WithSyslogPriority recognizes the <PRI> that starts a syslog line and stores
+// the facility and severity it encodes under "facility" and "severity", so
+// <134> yields facility=16 severity=6.  the rest of the line is parsed as
+// usual.  see lex.WithSyslogPriority.
+func WithSyslogPriority(syslog bool) func(*Parser) error {
+	return func(p *Parser) error {
+		p.lexOpts = append(p.lexOpts, lex.WithSyslogPriority(syslog))
+		return nil
+	}
+}
+
+// storePriority stores the facility and severity of the syslog priority pri
+// in kvp.
+func (p *Parser) storePriority(kvp map[string]interface{}, pri int64) {
+	p.store(kvp, "facility", pri/8)
+	p.store(kvp, "severity", pri%8)
+}
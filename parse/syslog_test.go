@@ -0,0 +1,55 @@
+package parse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSyslogPriority(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		syslog   bool
+		expected []map[string]interface{}
+	}{
+		"Priority": {
+			input:    "<134>msg=hi\n",
+			syslog:   true,
+			expected: []map[string]interface{}{{"facility": int64(16), "severity": int64(6), "msg": "hi"}},
+		},
+		"Each Line": {
+			input:  "<0>a=1\nb=2\n<14>c=3\n",
+			syslog: true,
+			expected: []map[string]interface{}{
+				{"facility": int64(0), "severity": int64(0), "a": int64(1)},
+				{"b": int64(2)},
+				{"facility": int64(1), "severity": int64(6), "c": int64(3)},
+			},
+		},
+		"Priority Alone": {
+			input:    "<134>\n",
+			syslog:   true,
+			expected: []map[string]interface{}{{"facility": int64(16), "severity": int64(6)}},
+		},
+		"Not At Line Start": {
+			input:    "a=<134>\n",
+			syslog:   true,
+			expected: []map[string]interface{}{{"a": "<134>"}},
+		},
+		"Off By Default": {
+			input:    "<134>msg=hi\n",
+			expected: []map[string]interface{}{{"<134>msg": "hi"}},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := parseAll(t, test.input, WithSyslogPriority(test.syslog))
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("parsing %q yielded %#v; expected %#v", test.input, got, test.expected)
+			}
+		})
+	}
+}
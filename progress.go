@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// progress keeps track of how far through the input parsing is, for
+// -progress.  input is counted as it is read, so the counts move on while a
+// large file is still being parsed.
+type progress struct {
+	// read, lines and size are only used atomically.  size is the total size
+	// of the inputs, and unsized is set once an input of unknown size, such
+	// as a pipe, has been opened.
+	read    int64
+	lines   int64
+	size    int64
+	unsized int32
+
+	delim []byte
+	now   func() time.Time
+
+	// then is when progress was last reported, at which point seen lines had
+	// been read.
+	then time.Time
+	seen int64
+}
+
+func newProgress(delimiter rune, now func() time.Time) *progress {
+	return &progress{delim: []byte(string(delimiter)), now: now}
+}
+
+// countingReader passes what is read from r to count.
+type countingReader struct {
+	r     io.Reader
+	count func([]byte)
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.count(b[:n])
+	return n, err
+}
+
+// countBytes returns r, counting the bytes read from it.  it wraps the input as
+// it was stored, so compressed input is counted compressed.
+func (p *progress) countBytes(r io.Reader) io.Reader {
+	return &countingReader{r: r, count: func(b []byte) { atomic.AddInt64(&p.read, int64(len(b))) }}
+}
+
+// countLines returns r, counting the delimiters read from it.
+func (p *progress) countLines(r io.Reader) io.Reader {
+	return &countingReader{r: r, count: func(b []byte) { atomic.AddInt64(&p.lines, int64(bytes.Count(b, p.delim))) }}
+}
+
+// addInput adds the size of r to the total if r is a regular file.
+func (p *progress) addInput(r io.Reader) {
+	if f, isFile := r.(*os.File); isFile {
+		if fi, err := f.Stat(); err == nil && fi.Mode().IsRegular() {
+			atomic.AddInt64(&p.size, fi.Size())
+			return
+		}
+	}
+	atomic.StoreInt32(&p.unsized, 1)
+}
+
+// report writes the counts so far to w, along with the lines read a second
+// since the last report.  the share of the input read is only given when the
+// size of every input is known.
+func (p *progress) report(w io.Writer) {
+	now, lines, read := p.now(), atomic.LoadInt64(&p.lines), atomic.LoadInt64(&p.read)
+
+	rate := 0.0
+	if d := now.Sub(p.then).Seconds(); d > 0 {
+		rate = float64(lines-p.seen) / d
+	}
+	p.then, p.seen = now, lines
+
+	fmt.Fprintf(w, "progress: %d lines, %d bytes", lines, read)
+	if size := atomic.LoadInt64(&p.size); size > 0 && atomic.LoadInt32(&p.unsized) == 0 {
+		fmt.Fprintf(w, " (%.1f%%)", 100*float64(read)/float64(size))
+	}
+	fmt.Fprintf(w, ", %.0f lines/s\n", rate)
+}
+
+// start reports progress to w every interval until the function it returns is
+// called, which reports one last time.
+func (p *progress) start(w io.Writer, interval time.Duration) (stop func()) {
+	p.then = p.now()
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.report(w)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+		p.report(w)
+	}
+}
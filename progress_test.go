@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ayang64/ginsu/parse"
+)
+
+func TestProgress(t *testing.T) {
+	start := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	clock := start
+	p := newProgress('\n', func() time.Time { return clock })
+	p.then = start
+
+	// the input is compressed, so bytes are counted as stored and lines as
+	// parsed.
+	compressed := &bytes.Buffer{}
+	zw := gzip.NewWriter(compressed)
+	io.WriteString(zw, strings.Repeat("a=1\n", 100))
+	zw.Close()
+	stored := int64(compressed.Len())
+
+	path := filepath.Join(t.TempDir(), "app.log.gz")
+	if err := ioutil.WriteFile(path, compressed.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	p.addInput(f)
+
+	r, err := parse.Decompress(p.countBytes(f))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = p.countLines(r)
+
+	// the counts advance as the input is read.
+	buf := make([]byte, 40)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatal(err)
+	}
+	if p.lines != 10 || p.read == 0 {
+		t.Fatalf("reading 40 bytes counted %d lines and %d bytes; expected 10 lines and some bytes", p.lines, p.read)
+	}
+
+	if _, err := io.Copy(ioutil.Discard, r); err != nil {
+		t.Fatal(err)
+	}
+
+	clock = start.Add(2 * time.Second)
+	sb := &strings.Builder{}
+	p.report(sb)
+	if got, expected := sb.String(), "progress: 100 lines, "+strconv.FormatInt(stored, 10)+" bytes (100.0%), 50 lines/s\n"; got != expected {
+		t.Fatalf("progress reported %q; expected %q", got, expected)
+	}
+
+	// input of unknown size leaves the share out.
+	p.addInput(strings.NewReader(""))
+	clock = clock.Add(time.Second)
+	sb.Reset()
+	p.report(sb)
+	if got, expected := sb.String(), "progress: 100 lines, "+strconv.FormatInt(stored, 10)+" bytes, 0 lines/s\n"; got != expected {
+		t.Fatalf("progress reported %q; expected %q", got, expected)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import "strings"
+
+// parseFields splits a -fields argument into its key names, ignoring empty
+// entries.
+func parseFields(s string) []string {
+	fields := []string{}
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// project returns a record holding only the listed keys.  keys missing from
+// rec are left out.
+func project(rec map[string]interface{}, fields []string) map[string]interface{} {
+	projected := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		if v, exists := rec[f]; exists {
+			projected[f] = v
+		}
+	}
+	return projected
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProject(t *testing.T) {
+	tests := map[string]struct {
+		fields   string
+		expected map[string]interface{}
+	}{
+		"Subset":      {fields: "a,c", expected: map[string]interface{}{"a": "1", "c": "3"}},
+		"Missing Key": {fields: "a,z", expected: map[string]interface{}{"a": "1"}},
+		"Spaces":      {fields: " b , c ,", expected: map[string]interface{}{"b": "2", "c": "3"}},
+	}
+
+	rec := map[string]interface{}{"a": "1", "b": "2", "c": "3"}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := project(rec, parseFields(test.fields)); !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("projecting %v onto %q yielded %v; expected %v", rec, test.fields, got, test.expected)
+			}
+		})
+	}
+}
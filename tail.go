@@ -0,0 +1,42 @@
+package main
+
+import "errors"
+
+// errHeadReached stops reading input once -head records have been rendered.
+var errHeadReached = errors.New("head reached")
+
+// ring keeps the last records added to it, for -tail.
+type ring struct {
+	recs []map[string]interface{}
+	next int
+	full bool
+}
+
+func newRing(n int) *ring {
+	return &ring{recs: make([]map[string]interface{}, n)}
+}
+
+func (r *ring) add(rec map[string]interface{}) error {
+	r.recs[r.next] = rec
+	if r.next++; r.next == len(r.recs) {
+		r.next, r.full = 0, true
+	}
+	return nil
+}
+
+// each calls fn with the records kept, oldest first.
+func (r *ring) each(fn func(map[string]interface{}) error) error {
+	if r.full {
+		for _, rec := range r.recs[r.next:] {
+			if err := fn(rec); err != nil {
+				return err
+			}
+		}
+	}
+	for _, rec := range r.recs[:r.next] {
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/ayang64/ginsu/encode"
+	"github.com/ayang64/ginsu/parse"
+)
+
+// templateCase is a single -case flag: the template file that renders the
+// records whose -tmpl-switch key holds value.
+type templateCase struct {
+	value string
+	path  string
+}
+
+// templateCases collects repeated -case flags.
+type templateCases []templateCase
+
+func (cs *templateCases) String() string {
+	s := make([]string, 0, len(*cs))
+	for _, c := range *cs {
+		s = append(s, c.value+"="+c.path)
+	}
+	return strings.Join(s, " ")
+}
+
+// Set splits s at its first '=', so the value can't hold one but the path
+// can.
+func (cs *templateCases) Set(s string) error {
+	i := strings.IndexByte(s, '=')
+	if i < 0 || s[i+1:] == "" {
+		return fmt.Errorf("%q is not of the form value=templatefile", s)
+	}
+	*cs = append(*cs, templateCase{value: s[:i], path: s[i+1:]})
+	return nil
+}
+
+// encoders parses the template file of each case.
+func (cs templateCases) encoders() (map[string]encode.Encoder, error) {
+	encs := make(map[string]encode.Encoder, len(cs))
+	for _, c := range cs {
+		if _, exists := encs[c.value]; exists {
+			return nil, fmt.Errorf("-case %q is given more than once", c.value)
+		}
+		tmpl, err := template.New(filepath.Base(c.path)).Funcs(parse.FuncMap()).ParseFiles(c.path)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse template file: %v", err)
+		}
+		encs[c.value] = encode.NewTemplate(tmpl)
+	}
+	return encs, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ayang64/ginsu/parse"
+)
+
+// validator collects the lines of an input that didn't parse cleanly: lines
+// with errors and lines that yielded an empty record.
+//
+// records don't carry the number of their line when they are empty, so it is
+// worked out by counting them.  every line yields exactly one record, except
+// lines with errors which yield none.  ParseFunc reports errors and records
+// on a single goroutine in input order, so the count stays in step.
+type validator struct {
+	path   string
+	w      io.Writer
+	failed map[int]bool
+	next   int
+}
+
+func newValidator(path string, w io.Writer) *validator {
+	return &validator{path: path, w: w, failed: map[int]bool{}, next: 1}
+}
+
+// invalid reports how many lines failed validation.
+func (v *validator) invalid() int {
+	return len(v.failed)
+}
+
+func (v *validator) error(err error) {
+	var lineErr *parse.LineError
+	if !errors.As(err, &lineErr) {
+		fmt.Fprintf(v.w, "%s: %v\n", v.path, err)
+		return
+	}
+
+	if !v.failed[lineErr.Line] {
+		fmt.Fprintf(v.w, "%s:%d: %v\n", v.path, lineErr.Line, lineErr.Err)
+	}
+	v.failed[lineErr.Line] = true
+}
+
+func (v *validator) record(m map[string]interface{}) error {
+	for v.failed[v.next] {
+		v.next++
+	}
+
+	if len(m) == 0 {
+		fmt.Fprintf(v.w, "%s:%d: empty record\n", v.path, v.next)
+		v.failed[v.next] = true
+	}
+	v.next++
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"io"
+
+	"github.com/ayang64/ginsu/parse"
+)
+
+// lineResult is what a worker made of a single line of input.  records holds
+// whatever still needs rendering; output that could be rendered by the worker
+// itself is in rendered.
+type lineResult struct {
+	records  []map[string]interface{}
+	rendered []byte
+	stats    parse.Stats
+	err      error
+}
+
+type lineJob struct {
+	line   []byte
+	result chan<- lineResult
+}
+
+// parallel splits r into lines and hands each one to fn on one of n
+// goroutines.  the results are passed to yield in the order of the lines they
+// came from, so the output doesn't depend on how the work was scheduled.
+//
+// every line gets its own result channel and the channels are queued in input
+// order; that queue is the reorder buffer and its capacity bounds how far the
+// workers can run ahead of yield.
+//
+// the first error, from fn or yield, stops the lines being read and is
+// returned straight away.  a read already in progress is left to finish on its
+// own, so an open pipe doesn't hold up the return.
+func parallel(r io.Reader, n int, fn func(line []byte) lineResult, yield func(lineResult) error) error {
+	jobs := make(chan lineJob)
+	queue := make(chan chan lineResult, n)
+	done := make(chan struct{})
+
+	for i := 0; i < n; i++ {
+		go func() {
+			for job := range jobs {
+				job.result <- fn(job.line)
+			}
+		}()
+	}
+
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(jobs)
+		defer close(queue)
+
+		br := bufio.NewReader(r)
+		for {
+			line, err := br.ReadBytes('\n')
+			if len(line) > 0 {
+				result := make(chan lineResult, 1)
+				select {
+				case queue <- result:
+				case <-done:
+					return
+				}
+				select {
+				case jobs <- lineJob{line: line, result: result}:
+				case <-done:
+					return
+				}
+			}
+			if err != nil {
+				if err == io.EOF {
+					err = nil
+				}
+				readErr <- err
+				return
+			}
+		}
+	}()
+
+	for result := range queue {
+		res := <-result
+		if res.err == nil {
+			res.err = yield(res)
+		}
+		if res.err != nil {
+			close(done)
+			return res.err
+		}
+	}
+	return <-readErr
+}